@@ -1,10 +1,498 @@
 package controllers
 
 import (
+	"errors"
+	"io"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+	"github.com/adeindriawan/itsfood-administration/utils"
 )
 
 func Dashboard(c *gin.Context) {
 	response := "Hello from dashboard"
 	c.Data(200, "text/html; charset:utf-8", []byte(response))
-}
\ No newline at end of file
+}
+
+// respondAdminAccountError answers 422 for a change which is not allowed, 404
+// for an unknown admin and 512 when the database fails.
+func respondAdminAccountError(c *gin.Context, err error, description string) {
+	var code = 512
+	var accountError models.AdminAccountError
+	if errors.As(err, &accountError) {
+		code = 422
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		code = 404
+	}
+	c.JSON(code, gin.H{
+		"status":      "failed",
+		"errors":      err.Error(),
+		"result":      nil,
+		"description": description,
+	})
+}
+
+// DeactivateAdmin sets an admin to Inactive and ends all of its sessions.
+func DeactivateAdmin(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal menonaktifkan admin",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	admin, revoked, err := models.DeactivateAdmin(services.DB, adminId, adminContext)
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal menonaktifkan admin yang dimaksud.")
+		return
+	}
+	models.NotifyGroupTemplate("admin_deactivated.txt", gin.H{"Admin": admin.Name, "By": adminContext.User.Name})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"admin": models.NewAdminView(admin), "revoked_sessions": revoked},
+		"description": "Berhasil menonaktifkan admin yang dimaksud.",
+	})
+}
+
+type UnlockAdminLoginInput struct {
+	IP string `json:"ip" binding:"omitempty,ip"`
+}
+
+// UnlockAdminLogin lifts the lock on the email of an admin after too many
+// failed logins, before it runs out by itself. The IP the admin logs in from
+// can be given to lift its lock as well.
+func UnlockAdminLogin(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal membuka kunci login admin",
+		})
+		return
+	}
+	// the body is optional, it only carries the IP to unlock
+	var input UnlockAdminLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var admin models.Admin
+	if err := services.DB.Preload("User").First(&admin, adminId).Error; err != nil {
+		respondAdminAccountError(c, err, "Gagal menemukan admin dengan ID yang dimaksud.")
+		return
+	}
+
+	unlocked, err := utils.UnlockLogin(admin.User.Email, input.IP)
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal membuka kunci login admin yang dimaksud.",
+		})
+		return
+	}
+	if unlocked {
+		models.RecordSecurityEvent(models.SecurityEvent{
+			UserID:    admin.UserID,
+			Type:      models.SecurityEventLoginUnlocked,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Detail:    "login unlocked by " + adminContext.User.Name,
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"unlocked": unlocked, "ip": input.IP},
+		"description": "Berhasil membuka kunci login admin yang dimaksud.",
+	})
+}
+
+func GetPendingAdmins(c *gin.Context) {
+	admins, err := models.GetPendingAdmins(services.DB)
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengambil daftar admin yang menunggu persetujuan.",
+		})
+		return
+	}
+
+	var adminViews = []models.AdminView{}
+	for _, admin := range admins {
+		adminViews = append(adminViews, models.NewAdminView(admin))
+	}
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"data": adminViews},
+		"description": "Berhasil mengambil daftar admin yang menunggu persetujuan.",
+	})
+}
+
+// ApproveAdmin activates a self-registered admin and emails the applicant.
+func ApproveAdmin(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal menyetujui admin",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var admin models.Admin
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		admin, err = models.ApproveAdmin(tx, adminId, adminContext)
+		return err
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal menyetujui admin yang dimaksud.")
+		return
+	}
+
+	models.NotifyTemplate(services.ChannelEmail, admin.User.Email, "admin_approved.html", gin.H{"Name": admin.Name})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      models.NewAdminView(admin),
+		"description": "Berhasil menyetujui admin yang dimaksud.",
+	})
+}
+
+type RejectAdminInput struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// RejectAdmin turns down a self-registered admin and emails the applicant the
+// reason.
+func RejectAdmin(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal menolak admin",
+		})
+		return
+	}
+	var input RejectAdminInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var admin models.Admin
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		admin, err = models.RejectAdmin(tx, adminId, input.Reason, adminContext)
+		return err
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal menolak admin yang dimaksud.")
+		return
+	}
+
+	models.NotifyTemplate(services.ChannelEmail, admin.User.Email, "admin_rejected.html", gin.H{"Name": admin.Name, "Reason": input.Reason})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      models.NewAdminView(admin),
+		"description": "Berhasil menolak admin yang dimaksud.",
+	})
+}
+
+func GetAdmins(c *gin.Context) {
+	var admins []models.Admin
+	var messages = []string{}
+
+	params := c.Request.URL.Query()
+
+	lengthParam, doesLengthParamExist := params["length"]
+	pageParam, doesPageParamExist := params["page"]
+	searchParam, doesSearchParamExist := params["search"]
+	statusParam, doesStatusParamExist := params["status"]
+
+	adminsQuery := services.DB.Model(&models.Admin{}).Preload("User")
+
+	if doesSearchParamExist {
+		search := "%" + searchParam[0] + "%"
+		adminsQuery = adminsQuery.Where("admins.name LIKE ? OR admins.email LIKE ?", search, search)
+	}
+
+	if doesStatusParamExist {
+		adminsQuery = adminsQuery.Where("admins.status = ?", statusParam[0])
+	}
+
+	var totalRows int64
+	adminsQuery.Count(&totalRows)
+
+	if doesLengthParamExist {
+		length, err := strconv.Atoi(lengthParam[0])
+		if err != nil {
+			messages = append(messages, "Parameter Length tidak dapat dikonversi ke integer")
+		} else {
+			adminsQuery = adminsQuery.Limit(length)
+		}
+	}
+
+	if doesPageParamExist {
+		if doesLengthParamExist {
+			page, _ := strconv.Atoi(pageParam[0])
+			length, _ := strconv.Atoi(lengthParam[0])
+			offset := (page - 1) * length
+			adminsQuery = adminsQuery.Offset(offset)
+		} else {
+			messages = append(messages, "Tidak ada parameter Length, maka parameter Page diabaikan.")
+		}
+	}
+
+	adminsQuery.Order("admins.id").Find(&admins)
+	rowsCount := adminsQuery.RowsAffected
+
+	if adminsQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      adminsQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query.",
+		})
+		return
+	}
+
+	var adminViews = []models.AdminView{}
+	for _, admin := range admins {
+		adminViews = append(adminViews, models.NewAdminView(admin))
+	}
+
+	adminData := map[string]interface{}{
+		"data":       adminViews,
+		"rows_count": rowsCount,
+		"total_rows": totalRows,
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"result":      adminData,
+		"errors":      messages,
+		"description": "Berhasil mengambil data admin.",
+	})
+}
+
+// GetAdmin shows an admin together with its roles and the earlier versions of
+// its data.
+func GetAdmin(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengambil data admin",
+		})
+		return
+	}
+
+	admin, err := models.GetAdmin(services.DB, adminId)
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal menemukan admin dengan ID yang dimaksud.")
+		return
+	}
+	adminRoles, err := models.GetAdminRoles(services.DB, adminId)
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal mengambil role admin dari database.")
+		return
+	}
+	history, err := models.GetAdminHistory(services.DB, adminId)
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal mengambil riwayat perubahan admin dari database.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"errors": nil,
+		"result": map[string]interface{}{
+			"admin":   models.NewAdminView(admin),
+			"roles":   adminRoles,
+			"history": history,
+		},
+		"description": "Berhasil mengambil data admin.",
+	})
+}
+
+type UpdateAdminInput struct {
+	Name            *string `json:"name" binding:"omitempty,min=1"`
+	Email           *string `json:"email" binding:"omitempty,email"`
+	Phone           *string `json:"phone" binding:"omitempty,min=1"`
+	CurrentPassword *string `json:"current_password"`
+}
+
+func (input UpdateAdminInput) profile() models.AdminProfile {
+	return models.AdminProfile{Name: input.Name, Email: input.Email, Phone: input.Phone, CurrentPassword: input.CurrentPassword}
+}
+
+// updateAdminProfile applies the profile in the request to adminId, for both
+// UpdateAdmin and UpdateMyProfile. Admins changing their own email have to
+// send their current password, and after an email change the other sessions
+// of the admin are ended.
+func updateAdminProfile(c *gin.Context, adminId uint64) {
+	var input UpdateAdminInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	admin, err := models.UpdateAdminProfile(services.DB, adminId, input.profile(), adminContext, currentSessionId(c))
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal mengubah data admin.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      models.NewAdminView(admin),
+		"description": "Berhasil mengubah data admin.",
+	})
+}
+
+func UpdateAdmin(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengubah data admin",
+		})
+		return
+	}
+	updateAdminProfile(c, adminId)
+}
+
+func UpdateMyProfile(c *gin.Context) {
+	updateAdminProfile(c, c.MustGet("admin").(models.Admin).ID)
+}
+
+// ReactivateAdmin sets a deactivated admin back to Active.
+func ReactivateAdmin(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengaktifkan kembali admin",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var admin models.Admin
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		admin, err = models.ReactivateAdmin(tx, adminId, adminContext)
+		return err
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal mengaktifkan kembali admin yang dimaksud.")
+		return
+	}
+
+	models.NotifyGroupTemplate("admin_reactivated.txt", gin.H{"Admin": admin.Name, "By": adminContext.User.Name})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      models.NewAdminView(admin),
+		"description": "Berhasil mengaktifkan kembali admin yang dimaksud.",
+	})
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	ConfirmPassword string `json:"confirm_password" binding:"required"`
+}
+
+// ChangeMyPassword sets a new password for the admin of the request, and ends
+// its other sessions.
+func ChangeMyPassword(c *gin.Context) {
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	if input.Password != input.ConfirmPassword {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Gagal memvalidasi data yang masuk",
+			"result":      nil,
+			"description": "Data password tidak sama dengan confirm password yang dikirim.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	revoked, err := models.ChangeAdminPassword(services.DB, adminContext, input.CurrentPassword, input.Password, currentSessionId(c))
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal mengganti password.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"revoked_sessions": revoked},
+		"description": "Berhasil mengganti password. Sesi lain dari admin ini sudah diakhiri.",
+	})
+}
@@ -2,19 +2,91 @@ package controllers
 
 import (
 	"os"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 	"strconv"
+	"strings"
+	"net/url"
 	"github.com/gin-gonic/gin"
 	"github.com/adeindriawan/itsfood-administration/models"
 	"github.com/adeindriawan/itsfood-administration/services"
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/twinj/uuid"
+	redis "github.com/go-redis/redis/v7"
+	"gorm.io/gorm"
 	"github.com/adeindriawan/itsfood-administration/utils"
 )
 
+// a reset link is valid this long, and only once
+const resetTokenDuration = 15 * time.Minute
+
+// how many reset emails can be asked for within resetRequestWindow, per email
+// address and per client IP
+const (
+	resetRequestsPerEmail = 3
+	resetRequestsPerIP    = 10
+	resetRequestWindow    = time.Hour
+)
+
+func resetTokenKey(token string) string {
+	return "password-reset:" + token
+}
+
+func resetEmailKey(email string) string {
+	return "password-reset-email:" + email
+}
+
+// consumeResetToken reads the email of a reset token and deletes the token in
+// one go. It returns redis.Nil when the token does not exist.
+func consumeResetToken(token string) (string, error) {
+	pipe := services.GetRedis().TxPipeline()
+	email := pipe.Get(resetTokenKey(token))
+	pipe.Del(resetTokenKey(token))
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return "", err
+	}
+	return email.Result()
+}
+
+// resetPasswordLink points to the page of the admin app where a new password
+// is set, which sends the token and email back to ResetPassword.
+func resetPasswordLink(token string, email string) string {
+	query := url.Values{}
+	query.Set("token", token)
+	query.Set("email", email)
+	return os.Getenv("RESET_PASSWORD_URL") + "?" + query.Encode()
+}
+
 type ForgotPasswordPayload struct {
-	Email string `json:"email"`
+	Email string `json:"email" binding:"required,email"`
+}
+
+// allowResetRequest counts a reset request against the limit of key, and
+// answers the request itself when it cannot go ahead.
+func allowResetRequest(c *gin.Context, key string, limit int64) bool {
+	allowed, retryAfter, err := utils.RateLimit(key, limit, resetRequestWindow)
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status": "failed",
+			"errors": err.Error(),
+			"result": nil,
+			"description": "Gagal memeriksa batas permintaan reset password.",
+		})
+		return false
+	}
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		c.JSON(429, gin.H{
+			"status": "failed",
+			"errors": "Terlalu banyak permintaan reset password.",
+			"result": nil,
+			"description": "Silakan coba lagi dalam " + strconv.Itoa(int(retryAfter.Minutes())+1) + " menit.",
+		})
+		return false
+	}
+	return true
 }
 
 func ForgotPassword(c *gin.Context) {
@@ -29,7 +101,27 @@ func ForgotPassword(c *gin.Context) {
 		})
 		return
 	}
-	query := services.DB.First(&user, "email = ?", payload.Email)
+	email := strings.ToLower(strings.TrimSpace(payload.Email))
+
+	// the IP is counted first, so a request it blocks never uses up a slot of
+	// the email
+	if !allowResetRequest(c, "forgot-password-ip:"+c.ClientIP(), resetRequestsPerIP) {
+		return
+	}
+	if !allowResetRequest(c, "forgot-password-email:"+email, resetRequestsPerEmail) {
+		return
+	}
+
+	// the answer is the same whether the email is registered or not, so it
+	// cannot be used to find out who has an account
+	uniformResponse := gin.H{
+		"status": "success",
+		"errors": nil,
+		"result": nil,
+		"description": "Jika email tersebut terdaftar, tautan untuk mengganti password sudah dikirimkan ke alamat tersebut.",
+	}
+
+	query := services.DB.Where("email = ?", email).Limit(1).Find(&user)
 	if query.Error != nil {
 		c.JSON(512, gin.H{
 			"status": "failed",
@@ -39,49 +131,44 @@ func ForgotPassword(c *gin.Context) {
 		})
 		return
 	}
-
-	resetToken := uuid.NewV4().String()
-	mailTo := user.Email
-	mailSubject := "[ITS Food] Lupa Kata Sandi"
-	mailBody := resetToken
-
-	resetTokenExpires := time.Now().Add(time.Minute * 15).UnixMilli()
-	rtx := time.Unix(resetTokenExpires, 0)
-	now := time.Now()
-	if err := services.GetRedis().Set(resetToken, mailTo, rtx.Sub(now)).Err(); err != nil {
-		c.JSON(512, gin.H{
-			"status": "failed",
-			"errors": err.Error(),
-			"result": nil,
-			"description": "Gagal menyimpan reset token pada database.",
-		})
+	if query.RowsAffected == 0 {
+		c.JSON(200, uniformResponse)
 		return
 	}
 
-	_, errorSendingResetPasswordEmail := services.SendMail(mailTo, mailSubject, mailBody)
-	if errorSendingResetPasswordEmail != nil {
+	resetToken := uuid.NewV4().String()
+	// a new link replaces the one sent before
+	if previousToken, err := services.GetRedis().Get(resetEmailKey(user.Email)).Result(); err == nil {
+		services.GetRedis().Del(resetTokenKey(previousToken))
+	}
+	errSaving := services.GetRedis().Set(resetTokenKey(resetToken), user.Email, resetTokenDuration).Err()
+	if errSaving == nil {
+		errSaving = services.GetRedis().Set(resetEmailKey(user.Email), resetToken, resetTokenDuration).Err()
+	}
+	if errSaving != nil {
 		c.JSON(512, gin.H{
 			"status": "failed",
-			"errors": nil,
+			"errors": errSaving.Error(),
 			"result": nil,
-			"description": "Gagal mengirim email berisi token ke alamat " + mailTo,
+			"description": "Gagal menyimpan reset token pada database.",
 		})
 		return
 	}
 
-	c.JSON(200, gin.H{
-		"status": "success",
-		"errors": nil,
-		"result": user,
-		"description": "Sukses mengirim email berisi token ke alamat " + mailTo,
+	models.NotifyTemplate(services.ChannelEmail, user.Email, "password_reset.html", gin.H{
+		"Name": user.Name,
+		"Link": resetPasswordLink(resetToken, user.Email),
+		"ExpiresIn": int(resetTokenDuration.Minutes()),
 	})
+
+	c.JSON(200, uniformResponse)
 }
 
 type ResetPasswordPayload struct {
-	Email string `json:"email"`
-	Token string `json:"token"`
-	Password string `json:"password"`
-	ConfirmPassword string `json:"confirm_password"`
+	Email string `json:"email" binding:"required"`
+	Token string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	ConfirmPassword string `json:"confirm_password" binding:"required"`
 }
 
 func ResetPassword(c *gin.Context) {
@@ -106,26 +193,29 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	if email, err := services.GetRedis().Get(payload.Token).Result(); err != nil {
-		c.JSON(512, gin.H{
+	// the token is used up right away, so two requests with it cannot both
+	// get through
+	email, err := consumeResetToken(payload.Token)
+	if err == redis.Nil || (err == nil && !strings.EqualFold(email, strings.TrimSpace(payload.Email))) {
+		c.JSON(400, gin.H{
 			"status": "failed",
-			"errors": err.Error(),
+			"errors": "Token tidak valid atau sudah kadaluwarsa.",
 			"result": nil,
-			"description": "Token tidak ditemukan dalam database. Kemungkinan sudah kadaluwarsa.",
+			"description": "Silakan minta tautan reset password yang baru.",
 		})
 		return
-	} else if email != payload.Email {
-		c.JSON(400, gin.H{
+	} else if err != nil {
+		c.JSON(512, gin.H{
 			"status": "failed",
-			"errors": "Email yang terkirim tidak sama dengan email yang tersimpan dalam token di Redis.",
+			"errors": err.Error(),
 			"result": nil,
-			"description": "User dengan email ini tidak dapat mereset password.",
+			"description": "Gagal membaca reset token dari database.",
 		})
 		return
 	}
 
 	var user models.User
-	findUser := services.DB.First(&user, "email = ?", payload.Email)
+	findUser := services.DB.First(&user, "email = ?", email)
 	if findUser.Error != nil {
 		c.JSON(404, gin.H{
 			"status": "failed",
@@ -142,12 +232,11 @@ func ResetPassword(c *gin.Context) {
 			"status": "failed",
 			"errors": errHash.Error(),
 			"result": nil,
-			"descripion": "Gagal membuat hash dari password yang diberikan.",
+			"description": "Gagal membuat hash dari password yang diberikan.",
 		})
 		return
 	}
-	user.Password = hash
-	updatePassword := services.DB.Save(&user)
+	updatePassword := services.DB.Model(&user).Updates(map[string]interface{}{"password": hash, "updated_at": time.Now()})
 	if updatePassword.Error != nil {
 		c.JSON(512, gin.H{
 			"status": "failed",
@@ -157,11 +246,18 @@ func ResetPassword(c *gin.Context) {
 		})
 		return
 	}
+
+	// whoever was logged in with the old password has to log in again
+	services.GetRedis().Del(resetEmailKey(email))
+	if _, err := utils.DeleteUserSessions(user.ID, ""); err != nil {
+		log.Print("Failed to revoke the sessions of user #", user.ID, " after a password reset: ", err.Error())
+	}
+
 	c.JSON(200, gin.H{
 		"status": "success",
 		"errors": nil,
-		"result": hash,
-		"description": "Sukses mengganti password dari user ini.",
+		"result": nil,
+		"description": "Sukses mengganti password dari user ini. Silakan login kembali.",
 	})
 }
 
@@ -200,7 +296,7 @@ func AdminRegister(c *gin.Context) {
 		return
 	}
 
-	user := models.User{Name: register.Name, Email: register.Email, Password: hashedPassword, Phone: register.Phone, Type: "Admin", Status: "Registered", CreatedBy: register.Name, UpdatedAt: time.Time{}}
+	user := models.User{Name: register.Name, Email: register.Email, Password: hashedPassword, Phone: register.Phone, Type: "Admin", Status: models.UserRegistered, CreatedBy: register.Name, UpdatedAt: time.Time{}}
 	if errorCreatingUser := services.DB.Create(&user).Error; errorCreatingUser != nil {
 		c.JSON(512, gin.H{
 			"status": "failed",
@@ -223,11 +319,14 @@ func AdminRegister(c *gin.Context) {
 		return
 	}
 	
+	admin.User = user
+	models.NotifyGroupTemplate("admin_registered.txt", gin.H{"Name": admin.Name, "Email": admin.Email, "Phone": admin.Phone})
+
 	c.JSON(201, gin.H{
 		"status": "success",
 		"errors": nil,
-		"result": user,
-		"description": "Berhasil menambah admin baru.",
+		"result": models.NewAdminView(admin),
+		"description": "Berhasil mendaftar sebagai admin, silakan tunggu persetujuan dari super admin.",
 	})
 }
 
@@ -245,72 +344,69 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 
-	if err := services.DB.Where("email = ?", login.Email).First(&user).Error; err != nil {
-		c.JSON(404, gin.H{
+	retryAfter, err := utils.LoginRetryAfter(login.Email, c.ClientIP())
+	if err != nil {
+		c.JSON(512, gin.H{
 			"status": "failed",
 			"errors": err.Error(),
 			"result": nil,
-			"description": "Gagal menemukan user dengan email yang dikirimkan.",
+			"description": "Gagal memeriksa batas percobaan login.",
 		})
 		return
-	} else if user.Email != login.Email || !utils.CheckPasswordHash(login.Password, user.Password) {
-		c.JSON(422, gin.H{
-			"status": "failed",
-			"errors": "Gagal mengautentikasi.",
-			"result": nil,
-			"description": "Gagal mengautentikasi info login dari data yang dikirimkan.",
-		})
+	}
+	if retryAfter > 0 {
+		respondLoginRetryAfter(c, retryAfter)
 		return
-	} else {
-		if user.Type != "Admin" {
-			c.JSON(422, gin.H{
+	}
+
+	if err := services.DB.Where("email = ?", login.Email).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(512, gin.H{
 				"status": "failed",
-				"errors": "Not admin",
+				"errors": err.Error(),
 				"result": nil,
-				"description": "User yang bersangkutan bukan bertipe Admin.",
+				"description": "Gagal mengambil data user dari database.",
 			})
 			return
 		}
+		// take as long as checking a real password, so the time of the answer
+		// does not tell that the email is unknown
+		utils.CheckPasswordHash(login.Password, unknownUserPasswordHash)
+		failLogin(c, login.Email, user)
+		return
+	} else if user.Email != login.Email || !utils.CheckPasswordHash(login.Password, user.Password) || user.Type != "Admin" {
+		failLogin(c, login.Email, user)
+		return
+	} else {
 		var admin models.Admin
 		if err := services.DB.Preload("User").Where("user_id = ?", user.ID).First(&admin).Error; err != nil {
-			c.JSON(404, gin.H{
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				failLogin(c, login.Email, user)
+				return
+			}
+			c.JSON(512, gin.H{
 				"status": "failed",
 				"errors": err.Error(),
 				"result": nil,
-				"description": "Gagal menemukan data admin dengan ID user tersebut.",
+				"description": "Gagal mengambil data admin dari database.",
 			})
 			return
 		}
-		ts, err := utils.CreateToken(user.ID)
+		twoFactor, err := models.GetAdminTwoFactor(admin.ID)
 		if err != nil {
-			c.JSON(500, gin.H{
+			c.JSON(512, gin.H{
 				"status": "failed",
 				"errors": err.Error(),
 				"result": nil,
-				"description": "Tidak dapat membuat token untuk proses autentikasi.",
+				"description": "Gagal mengambil data 2FA dari admin ini.",
 			})
 			return
 		}
-		saveErr := utils.CreateAuth(user.ID, ts)
-		if saveErr != nil {
-			c.JSON(500, gin.H{
-				"status": "failed",
-				"errors": saveErr.Error(),
-				"result": nil,
-				"description": "Gagal membuat autentikasi user.",
-			})
+		if twoFactor.Enabled {
+			startTwoFactorLogin(c, admin)
 			return
 		}
-		data := map[string]interface{}{
-			"token": ts,
-			"admin": admin,
-		}
-		c.JSON(200, gin.H{
-			"status": "success",
-			"errors": nil,
-			"result": data,
-			"description": "Berhasil login",
-		})
+		issueLoginTokens(c, admin)
 	}
 }
 
@@ -338,18 +434,42 @@ func Logout(c *gin.Context) {
 	if errorFetchingAuth != nil {
 		c.JSON(500, gin.H{
 			"status": "failed",
-			"errors": err.Error(),
+			"errors": errorFetchingAuth.Error(),
 			"result": nil,
 			"description": "Gagal mengambil user ID.",
 		})
 		return
 	}
 
+	// logging out ends the whole session, its refresh token included
+	if au.SessionId != "" {
+		if err := utils.DeleteSession(au.UserId, au.SessionId); err != nil && err != redis.Nil {
+			c.JSON(500, gin.H{
+				"status": "failed",
+				"errors": err.Error(),
+				"result": nil,
+				"description": "Gagal mengakhiri sesi user.",
+			})
+			return
+		}
+		c.JSON(200, gin.H{
+			"status": "success",
+			"errors": nil,
+			"result": nil,
+			"description": "Berhasil log out.",
+		})
+		return
+	}
+
 	deleted, delErr := DeleteAuth(au.AccessUuid)
 	if delErr != nil || deleted == 0 {
+		var deleteError = "token sudah terhapus"
+		if delErr != nil {
+			deleteError = delErr.Error()
+		}
 		c.JSON(500, gin.H{
 			"status": "failed",
-			"errors": "Tidak ada token user yang terhapus: " + delErr.Error(),
+			"errors": "Tidak ada token user yang terhapus: " + deleteError,
 			"result": nil,
 			"description": "Error dalam menghapus token user atau tidak ada token yang terhapus.",
 		})
@@ -374,15 +494,9 @@ func Refresh(c *gin.Context) {
 		})
 		return
 	}
-	refreshSecret := os.Getenv("REFRESH_SECRET")
 	refreshToken := mapToken["refresh_token"]
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		// Make sure that the token method conform to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected string method: %v", token.Header["alg"])
-		}
-		return []byte(refreshSecret), nil
-	})
+	// the key is picked by the kid header of the token
+	token, err := utils.VerifyRefreshToken(refreshToken)
 	// If there is an error, the token must have expired
 	if err != nil {
 		c.JSON(403, gin.H{
@@ -410,7 +524,7 @@ func Refresh(c *gin.Context) {
 		if !ok {
 			c.JSON(500, gin.H{
 				"status": "failed",
-				"errors": err.Error(),
+				"errors": "Refresh token tidak memiliki refresh_uuid.",
 				"result": nil,
 				"description": "Gagal membuat access & refresh token yang baru.",
 			})
@@ -426,27 +540,37 @@ func Refresh(c *gin.Context) {
 			})
 			return
 		}
-		// Delete the previous refresh token
-		deleted, delErr := DeleteAuth(refreshUuid)
-		if delErr != nil || deleted == 0 {
-			var deleteError string = ""
-			if delErr != nil {
-				deleteError += delErr.Error()
+		// the new tokens stay in the session of the old ones
+		sessionId, _ := claims["session_id"].(string)
+		// Use up the previous refresh token
+		if err := utils.ConsumeRefreshToken(userId, refreshUuid, sessionId); err != nil {
+			if err == utils.ErrRefreshTokenReused {
+				models.RecordSecurityEvent(models.SecurityEvent{
+					UserID: userId,
+					Type: models.SecurityEventRefreshTokenReuse,
+					SessionID: sessionId,
+					IP: c.ClientIP(),
+					UserAgent: c.Request.UserAgent(),
+					Detail: "Refresh token " + refreshUuid + " yang sudah dirotasi dipakai lagi, sesi dicabut.",
+				})
+				var user models.User
+				services.DB.Select("name", "email").First(&user, userId)
+				models.NotifyGroupTemplate("security_refresh_reuse.txt", gin.H{"Name": user.Name, "Email": user.Email, "IP": c.ClientIP()})
 			}
-			var deletedError string = ""
-			if deleted == 0 {
-				deletedError += "Token sudah terhapus"
+			var code = 403
+			if err != utils.ErrRefreshTokenReused && err != utils.ErrRefreshTokenRevoked {
+				code = 500
 			}
-			c.JSON(500, gin.H{
+			c.JSON(code, gin.H{
 				"status": "failed",
-				"errors": "Error karena: " + deleteError + " | " + deletedError,
+				"errors": err.Error(),
 				"result": nil,
-				"description": "Tidak bisa membuat access & refresh token yang baru karena gagal menghapus refresh token yang lama.",
+				"description": "Tidak bisa membuat access & refresh token yang baru. Silakan login kembali.",
 			})
 			return
 		}
 		// Create new pairs of refresh and access token
-		ts, createErr := utils.CreateToken(userId)
+		ts, createErr := utils.CreateToken(userId, sessionId)
 		if createErr != nil {
 			c.JSON(500, gin.H{
 				"status": "failed",
@@ -457,7 +581,7 @@ func Refresh(c *gin.Context) {
 			return
 		}
 		// Save the token metadata to Redis
-		saveErr := utils.CreateAuth(userId, ts)
+		saveErr := utils.CreateAuth(userId, ts, utils.NewClientInfo(c.Request, c.ClientIP()))
 		if saveErr != nil {
 			c.JSON(500, gin.H{
 				"status": "failed",
@@ -485,3 +609,11 @@ func Refresh(c *gin.Context) {
 		})
 	}
 }
+
+// JWKS publishes the public keys of the access tokens in the standard JWKS
+// format, so other ITS Food services can verify them.
+func JWKS(c *gin.Context) {
+	c.JSON(200, gin.H{
+		"keys": utils.AccessTokenJWKS(),
+	})
+}
@@ -13,6 +13,8 @@ func GetCustomers(c *gin.Context) {
 	type CustomerResult struct {
 		models.Customer
 		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Phone    string `json:"phone"`
 		UnitName string `json:"unit_name"`
 	}
 
@@ -32,6 +34,8 @@ func GetCustomers(c *gin.Context) {
 			customers.id AS ID,
 			customers.user_id AS UserID,
 			users.name AS Name,
+			users.email AS Email,
+			users.phone AS Phone,
 			customers.type AS Type,
 			customers.unit_id AS UnitID,
 			units.name AS UnitName,
@@ -82,8 +86,17 @@ func GetCustomers(c *gin.Context) {
 		return
 	}
 
+	var customerViews = []models.CustomerView{}
+	for _, customer := range customers {
+		customer.Customer.User.Name = customer.Name
+		customer.Customer.User.Email = customer.Email
+		customer.Customer.User.Phone = customer.Phone
+		customer.Customer.Unit.Name = customer.UnitName
+		customerViews = append(customerViews, models.NewCustomerView(customer.Customer))
+	}
+
 	customerData := map[string]interface{}{
-		"data":       customers,
+		"data":       customerViews,
 		"rows_count": rowsCount,
 		"total_rows": totalRows,
 	}
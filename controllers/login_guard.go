@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+// unknownUserPasswordHash is checked against when the email of a login is not
+// registered, so such a login is as slow as one with a wrong password.
+var unknownUserPasswordHash, _ = utils.HashPassword("unknown-user")
+
+func respondLoginRetryAfter(c *gin.Context, retryAfter time.Duration) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(429, gin.H{
+		"status":      "failed",
+		"errors":      "Terlalu banyak percobaan login yang gagal.",
+		"result":      nil,
+		"description": "Silakan coba lagi dalam " + strconv.Itoa(seconds) + " detik.",
+	})
+}
+
+// countLoginFailure counts a failed login of email, at the password or at
+// the second factor, and raises the alarm when it locks the email or the IP.
+// user is empty when the email is unknown. It tells whether a lock was set.
+func countLoginFailure(c *gin.Context, email string, user models.User) bool {
+	lock, err := utils.RecordLoginFailure(email, c.ClientIP())
+	if err != nil {
+		log.Print("Failed to count the failed login of ", email, ": ", err.Error())
+	}
+	if !lock.Locked() {
+		return false
+	}
+
+	var lockedFor = "email"
+	if !lock.Email {
+		lockedFor = "IP"
+	}
+	models.RecordSecurityEvent(models.SecurityEvent{
+		UserID:    user.ID,
+		Type:      models.SecurityEventLoginLockout,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Detail:    "login of " + email + " locked by " + lockedFor + " after " + strconv.FormatInt(lock.Failures, 10) + " failures",
+	})
+	models.NotifyGroupTemplate("security_login_lockout.txt", gin.H{
+		"Email":    email,
+		"IP":       c.ClientIP(),
+		"LockedBy": lockedFor,
+		"Failures": lock.Failures,
+		"Minutes":  int(utils.LoginFailureWindow.Minutes()),
+	})
+	return true
+}
+
+// failLogin counts a failed login and answers it the same way whatever went
+// wrong, so it does not tell whether the email is registered. user is empty
+// when the email is unknown.
+func failLogin(c *gin.Context, email string, user models.User) {
+	countLoginFailure(c, email, user)
+	c.JSON(401, gin.H{
+		"status":      "failed",
+		"errors":      "Email atau password salah.",
+		"result":      nil,
+		"description": "Gagal mengautentikasi info login dari data yang dikirimkan.",
+	})
+}
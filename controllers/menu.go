@@ -0,0 +1,475 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+type MenuResult struct {
+	models.Menu
+	VendorName string `json:"vendor_name"`
+}
+
+// menuQuery selects the menus together with the name of their vendor.
+func menuQuery() *gorm.DB {
+	return services.DB.Table("menus").
+		Joins("LEFT JOIN vendors ON vendors.id = menus.vendor_id").
+		Joins("LEFT JOIN users ON users.id = vendors.user_id").
+		Select("menus.*, users.name AS vendor_name")
+}
+
+func GetMenus(c *gin.Context) {
+	var menus []MenuResult
+	var messages = []string{}
+
+	params := c.Request.URL.Query()
+
+	lengthParam, doesLengthParamExist := params["length"]
+	pageParam, doesPageParamExist := params["page"]
+	searchParam, doesSearchParamExist := params["search"]
+	vendorParam, doesVendorParamExist := params["vendor_id"]
+	typeParam, doesTypeParamExist := params["type"]
+	statusParam, doesStatusParamExist := params["status"]
+	minPriceParam, doesMinPriceParamExist := params["min_price"]
+	maxPriceParam, doesMaxPriceParamExist := params["max_price"]
+
+	menusQuery := menuQuery()
+
+	if doesSearchParamExist {
+		menusQuery = menusQuery.Where("menus.name LIKE ?", "%"+searchParam[0]+"%")
+	}
+
+	if doesVendorParamExist {
+		vendorId, err := strconv.ParseUint(vendorParam[0], 10, 64)
+		if err != nil {
+			messages = append(messages, "Parameter Vendor ID tidak dapat dikonversi ke integer, maka diabaikan.")
+		} else {
+			menusQuery = menusQuery.Where("menus.vendor_id = ?", vendorId)
+		}
+	}
+
+	if doesTypeParamExist {
+		menusQuery = menusQuery.Where("menus.type = ?", typeParam[0])
+	}
+
+	if doesStatusParamExist {
+		menusQuery = menusQuery.Where("menus.status = ?", statusParam[0])
+	}
+
+	if doesMinPriceParamExist {
+		minPrice, err := strconv.ParseUint(minPriceParam[0], 10, 64)
+		if err != nil {
+			messages = append(messages, "Parameter Min Price tidak dapat dikonversi ke integer, maka diabaikan.")
+		} else {
+			menusQuery = menusQuery.Where("menus.retail_price >= ?", minPrice)
+		}
+	}
+
+	if doesMaxPriceParamExist {
+		maxPrice, err := strconv.ParseUint(maxPriceParam[0], 10, 64)
+		if err != nil {
+			messages = append(messages, "Parameter Max Price tidak dapat dikonversi ke integer, maka diabaikan.")
+		} else {
+			menusQuery = menusQuery.Where("menus.retail_price <= ?", maxPrice)
+		}
+	}
+
+	var totalRows int64
+	menusQuery.Count(&totalRows)
+
+	if doesLengthParamExist {
+		length, err := strconv.Atoi(lengthParam[0])
+		if err != nil {
+			messages = append(messages, "Parameter Length tidak dapat dikonversi ke integer")
+		} else {
+			menusQuery = menusQuery.Limit(length)
+		}
+	}
+
+	if doesPageParamExist {
+		if doesLengthParamExist {
+			page, _ := strconv.Atoi(pageParam[0])
+			length, _ := strconv.Atoi(lengthParam[0])
+			offset := (page - 1) * length
+			menusQuery = menusQuery.Offset(offset)
+		} else {
+			messages = append(messages, "Tidak ada parameter Length, maka parameter Page diabaikan.")
+		}
+	}
+
+	menusQuery.Order("menus.id").Scan(&menus)
+	rowsCount := menusQuery.RowsAffected
+
+	if menusQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      menusQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query.",
+		})
+		return
+	}
+
+	menuData := map[string]interface{}{
+		"data":       menus,
+		"rows_count": rowsCount,
+		"total_rows": totalRows,
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"result":      menuData,
+		"errors":      messages,
+		"description": "Berhasil mengambil data menu.",
+	})
+}
+
+func GetMenu(c *gin.Context) {
+	menuId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengambil data menu",
+		})
+		return
+	}
+
+	var menu MenuResult
+	menusQuery := menuQuery().Where("menus.id = ?", menuId).Scan(&menu)
+	if menusQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      menusQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query menu.",
+		})
+		return
+	}
+	if menusQuery.RowsAffected == 0 {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      gorm.ErrRecordNotFound.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan menu dengan ID yang dimaksud.",
+		})
+		return
+	}
+
+	var prices []models.MenuPrice
+	if err := services.DB.Where("menu_id = ?", menuId).Order("changed_at DESC").Find(&prices).Error; err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query riwayat harga menu.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"errors": nil,
+		"result": map[string]interface{}{
+			"menu":   menu,
+			"prices": prices,
+		},
+		"description": "Berhasil mengambil data menu.",
+	})
+}
+
+type CreateMenuInput struct {
+	Name           string              `json:"name" binding:"required"`
+	Description    string              `json:"description"`
+	Type           models.MenuCategory `json:"type" binding:"required,oneof=Food Beverage Snack Fruit Grocery Others"`
+	COGS           uint                `json:"cogs" binding:"required"`
+	RetailPrice    uint                `json:"retail_price" binding:"required,gtefield=COGS"`
+	WholesalePrice uint                `json:"wholesale_price"`
+	MinOrderQty    uint                `json:"min_order_qty"`
+	MaxOrderQty    uint                `json:"max_order_qty"`
+	PreOrderDays   uint                `json:"pre_order_days"`
+	PreOrderHours  uint                `json:"pre_order_hours" binding:"max=23"`
+	Discount       float64             `json:"discount" binding:"min=0,max=100"`
+	Image          string              `json:"image"`
+	VendorID       uint                `json:"vendor_id" binding:"required"`
+	Status         string              `json:"status" binding:"omitempty,oneof=Active Inactive"`
+}
+
+func CreateMenu(c *gin.Context) {
+	var input CreateMenuInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	if input.MinOrderQty == 0 {
+		input.MinOrderQty = 1
+	}
+	if input.MaxOrderQty != 0 && input.MaxOrderQty < input.MinOrderQty {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Jumlah order maksimal tidak boleh kurang dari jumlah order minimal.",
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	if input.WholesalePrice == 0 {
+		input.WholesalePrice = input.RetailPrice
+	}
+	if input.Status == "" {
+		input.Status = "Active"
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var vendor models.Vendor
+	if err := services.DB.Preload("User").First(&vendor, input.VendorID).Error; err != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan vendor dengan ID yang dimaksud.",
+		})
+		return
+	}
+
+	now := time.Now()
+	menu := models.Menu{
+		Name:           input.Name,
+		Description:    input.Description,
+		Type:           input.Type,
+		COGS:           input.COGS,
+		RetailPrice:    input.RetailPrice,
+		WholesalePrice: input.WholesalePrice,
+		MinOrderQty:    input.MinOrderQty,
+		MaxOrderQty:    input.MaxOrderQty,
+		PreOrderDays:   input.PreOrderDays,
+		PreOrderHours:  input.PreOrderHours,
+		Discount:       input.Discount,
+		Image:          input.Image,
+		VendorID:       input.VendorID,
+		Status:         input.Status,
+		CreatedBy:      adminContext.User.Name,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := services.DB.Omit(clause.Associations).Create(&menu).Error; err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menyimpan data menu baru dalam database.",
+		})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      MenuResult{Menu: menu, VendorName: vendor.User.Name},
+		"description": "Berhasil menambah menu baru.",
+	})
+}
+
+type UpdateMenuInput struct {
+	Name           *string              `json:"name" binding:"omitempty,min=1"`
+	Description    *string              `json:"description"`
+	Type           *models.MenuCategory `json:"type" binding:"omitempty,oneof=Food Beverage Snack Fruit Grocery Others"`
+	COGS           *uint                `json:"cogs" binding:"omitempty,min=1"`
+	RetailPrice    *uint                `json:"retail_price" binding:"omitempty,min=1"`
+	WholesalePrice *uint                `json:"wholesale_price" binding:"omitempty,min=1"`
+	MinOrderQty    *uint                `json:"min_order_qty" binding:"omitempty,min=1"`
+	MaxOrderQty    *uint                `json:"max_order_qty"`
+	PreOrderDays   *uint                `json:"pre_order_days"`
+	PreOrderHours  *uint                `json:"pre_order_hours" binding:"omitempty,max=23"`
+	Discount       *float64             `json:"discount" binding:"omitempty,min=0,max=100"`
+	Image          *string              `json:"image"`
+	Status         *string              `json:"status" binding:"omitempty,oneof=Active Inactive"`
+}
+
+func UpdateMenu(c *gin.Context) {
+	var input UpdateMenuInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	menuId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengubah data menu",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var menu models.Menu
+	if err := services.DB.First(&menu, menuId).Error; err != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan menu dengan ID yang dimaksud.",
+		})
+		return
+	}
+
+	update := map[string]interface{}{}
+	if input.Name != nil {
+		update["name"] = *input.Name
+	}
+	if input.Description != nil {
+		update["description"] = *input.Description
+	}
+	if input.Type != nil {
+		update["type"] = *input.Type
+	}
+	if input.COGS != nil {
+		update["cogs"] = *input.COGS
+		menu.COGS = *input.COGS
+	}
+	if input.RetailPrice != nil {
+		update["retail_price"] = *input.RetailPrice
+		menu.RetailPrice = *input.RetailPrice
+	}
+	if input.WholesalePrice != nil {
+		update["wholesale_price"] = *input.WholesalePrice
+	}
+	if input.MinOrderQty != nil {
+		update["min_order_qty"] = *input.MinOrderQty
+		menu.MinOrderQty = *input.MinOrderQty
+	}
+	if input.MaxOrderQty != nil {
+		update["max_order_qty"] = *input.MaxOrderQty
+		menu.MaxOrderQty = *input.MaxOrderQty
+	}
+	if input.PreOrderDays != nil {
+		update["pre_order_days"] = *input.PreOrderDays
+	}
+	if input.PreOrderHours != nil {
+		update["pre_order_hours"] = *input.PreOrderHours
+	}
+	if input.Discount != nil {
+		update["discount"] = *input.Discount
+	}
+	if input.Image != nil {
+		update["image"] = *input.Image
+	}
+	if input.Status != nil {
+		update["status"] = *input.Status
+	}
+	if len(update) == 0 {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak ada data menu yang diubah.",
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+
+	// check the edited menu as a whole, not only the fields which were sent
+	if menu.RetailPrice < menu.COGS {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Harga jual tidak boleh kurang dari COGS.",
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	if menu.MaxOrderQty != 0 && menu.MaxOrderQty < menu.MinOrderQty {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Jumlah order maksimal tidak boleh kurang dari jumlah order minimal.",
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+
+	update["updated_at"] = time.Now()
+	update["created_by"] = adminContext.User.Name
+	errUpdatingMenu := services.DB.Transaction(func(tx *gorm.DB) error {
+		return models.UpdateMenu(tx, menuId, update, adminContext.User.Name)
+	})
+	if errUpdatingMenu != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      errUpdatingMenu.Error(),
+			"result":      nil,
+			"description": "Gagal mengubah data menu dalam database.",
+		})
+		return
+	}
+
+	var updatedMenu MenuResult
+	if err := menuQuery().Where("menus.id = ?", menuId).Scan(&updatedMenu).Error; err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query menu.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      updatedMenu,
+		"description": "Berhasil mengubah data menu.",
+	})
+}
+
+func DeactivateMenu(c *gin.Context) {
+	menuId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal menonaktifkan menu",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	errDeactivatingMenu := services.DB.Transaction(func(tx *gorm.DB) error {
+		return models.UpdateMenu(tx, menuId, map[string]interface{}{
+			"status":     "Inactive",
+			"updated_at": time.Now(),
+			"created_by": adminContext.User.Name,
+		}, adminContext.User.Name)
+	})
+	if errDeactivatingMenu != nil {
+		respondOrderMutationError(c, errDeactivatingMenu, "Gagal menonaktifkan menu yang dimaksud.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      nil,
+		"description": "Berhasil menonaktifkan menu yang dimaksud.",
+	})
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+func GetNotifications(c *gin.Context) {
+	var notifications []models.Notification
+	var messages = []string{}
+
+	params := c.Request.URL.Query()
+
+	lengthParam, doesLengthParamExist := params["length"]
+	pageParam, doesPageParamExist := params["page"]
+	statusParam, doesStatusParamExist := params["status"]
+	channelParam, doesChannelParamExist := params["channel"]
+
+	notificationQuery := services.DB.Model(&models.Notification{})
+
+	// status=Dead lists the notifications which gave up and wait for a retry
+	if doesStatusParamExist {
+		notificationQuery = notificationQuery.Where("status = ?", statusParam[0])
+	}
+
+	if doesChannelParamExist {
+		notificationQuery = notificationQuery.Where("channel = ?", channelParam[0])
+	}
+
+	var totalRows int64
+	notificationQuery.Count(&totalRows)
+
+	if doesLengthParamExist {
+		length, err := strconv.Atoi(lengthParam[0])
+		if err != nil {
+			messages = append(messages, "Parameter Length tidak dapat dikonversi ke integer")
+		} else {
+			notificationQuery = notificationQuery.Limit(length)
+		}
+	}
+
+	if doesPageParamExist {
+		if doesLengthParamExist {
+			page, _ := strconv.Atoi(pageParam[0])
+			length, _ := strconv.Atoi(lengthParam[0])
+			offset := (page - 1) * length
+			notificationQuery = notificationQuery.Offset(offset)
+		} else {
+			messages = append(messages, "Tidak ada parameter Length, maka parameter Page diabaikan.")
+		}
+	}
+
+	notificationQuery.Order("id DESC").Find(&notifications)
+	rowsCount := notificationQuery.RowsAffected
+
+	if notificationQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      notificationQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query.",
+		})
+		return
+	}
+
+	notificationData := map[string]interface{}{
+		"data":       notifications,
+		"rows_count": rowsCount,
+		"total_rows": totalRows,
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"result":      notificationData,
+		"errors":      messages,
+		"description": "Berhasil mengambil data notifikasi.",
+	})
+}
+
+func RetryNotification(c *gin.Context) {
+	notificationId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengirim ulang notifikasi",
+		})
+		return
+	}
+
+	notification, err := models.RetryNotification(services.DB, notificationId)
+	if err != nil {
+		code := 422
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			code = 404
+		}
+		c.JSON(code, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengirim ulang notifikasi yang dimaksud.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      notification,
+		"description": "Notifikasi akan segera dikirim ulang.",
+	})
+}
@@ -1,12 +1,17 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/url"
+	"os"
 	"runtime"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/adeindriawan/itsfood-administration/models"
 	"github.com/adeindriawan/itsfood-administration/services"
@@ -37,17 +42,16 @@ type OrderResult struct {
 }
 
 type OrderDetailResult struct {
-	ID          uint64 `json:"id"`
-	MenuName    string `json:"menu_name"`
-	MenuQty     uint   `json:"menu_qty"`
-	VendorName  string `json:"vendor_name"`
-	VendorPhone string `json:"vendor_phone"`
-	Note        string `json:"note"`
-	Status      string `json:"status"`
+	ID          uint64                   `json:"id"`
+	MenuName    string                   `json:"menu_name"`
+	MenuQty     uint                     `json:"menu_qty"`
+	VendorName  string                   `json:"vendor_name"`
+	VendorPhone string                   `json:"vendor_phone"`
+	Note        string                   `json:"note"`
+	Status      models.OrderDetailStatus `json:"status"`
 }
 
 func NotifyAVendorForAnOrder(c *gin.Context) {
-	var orderDetailModels []models.OrderDetail
 	var order OrderResult
 	var orderDetails []OrderDetailResult
 	orderId := c.Param("orderId")
@@ -97,76 +101,188 @@ func NotifyAVendorForAnOrder(c *gin.Context) {
 		return
 	}
 
-	if orderDetails[0].Status == "Sent" {
-		c.JSON(200, gin.H{
+	if len(orderDetails) == 0 {
+		c.JSON(404, gin.H{
 			"status":      "failed",
-			"errors":      "Tidak dapat mengirim notifikasi order baru ke vendor ini.",
-			"result":      orderDetails[0],
-			"description": "Order details ada yang sudah berstatus Sent.",
+			"errors":      "Tidak ada menu dari vendor ini pada order tersebut.",
+			"result":      nil,
+			"description": "Tidak dapat menemukan detail order untuk vendor yang dimaksud.",
 		})
 		return
 	}
 
-	vendorPhone := orderDetails[0].VendorPhone
-	vendorPhoneNumber, err := utils.SanitizePhoneNumber(vendorPhone)
-	if err != nil {
-		c.JSON(200, gin.H{
+	var orderDetailIds []uint64
+	for _, item := range orderDetails {
+		if item.Status != models.OrderDetailCancelled {
+			orderDetailIds = append(orderDetailIds, item.ID)
+		}
+	}
+
+	var vendor models.Vendor
+	if err := services.DB.First(&vendor, vendorId).Error; err != nil {
+		c.JSON(512, gin.H{
 			"status":      "failed",
-			"result":      nil,
 			"errors":      err.Error(),
-			"description": "Gagal mengolah data nomor telepon vendor.",
+			"result":      nil,
+			"description": "Gagal mengeksekusi query Vendor.",
 		})
 		return
 	}
 
-	orderedAt := utils.ConvertDateToPhrase(order.CreatedAt, true)
-	orderedFor := utils.ConvertDateToPhrase(order.OrderedFor, true)
-	var details = ""
-	for _, item := range orderDetails {
-		menuQty := strconv.Itoa(int(item.MenuQty))
-		details += item.MenuName + " " + menuQty + " porsi. Catatan: " + item.Note
-		models.UpdateOrderDetail(map[string]interface{}{"id": item.ID}, map[string]interface{}{"status": "Sent", "updated_at": time.Now(), "created_by": adminContext.User.Name})
+	// a vendor with a telegram ID does not need a phone number to be notified
+	var vendorPhoneNumber string
+	if vendor.VendorTelegramID == "" {
+		var err error
+		vendorPhoneNumber, err = utils.SanitizePhoneNumber(orderDetails[0].VendorPhone)
+		if err != nil {
+			c.JSON(200, gin.H{
+				"status":      "failed",
+				"result":      nil,
+				"errors":      err.Error(),
+				"description": "Gagal mengolah data nomor telepon vendor.",
+			})
+			return
+		}
 	}
 
-	var orderDetailSentStatus = []string{}
-	services.DB.Where("order_id = ?", orderId).Find(&orderDetailModels)
-	for _, item := range orderDetailModels {
-		if item.Status == "Sent" {
-			orderDetailSentStatus = append(orderDetailSentStatus, "Sent")
+	errSendingOrder := services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.TransitionOrderDetail(tx, map[string]interface{}{"id": orderDetailIds}, models.OrderDetailSent, map[string]interface{}{"updated_at": time.Now(), "created_by": adminContext.User.Name}); err != nil {
+			return err
+		}
+		_, err := models.RecountOrder(tx, order.ID, adminContext.User.Name)
+		return err
+	})
+	if errSendingOrder != nil {
+		var transitionError models.TransitionError
+		if errors.As(errSendingOrder, &transitionError) {
+			c.JSON(200, gin.H{
+				"status":      "failed",
+				"errors":      "Tidak dapat mengirim notifikasi order baru ke vendor ini: " + errSendingOrder.Error(),
+				"result":      orderDetails,
+				"description": "Order details ada yang sudah tidak dapat dikirim ke vendor.",
+			})
+			return
 		}
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      errSendingOrder.Error(),
+			"result":      nil,
+			"description": "Gagal memperbarui status order dan detail order.",
+		})
+		return
 	}
 
-	var status string
-	if len(orderDetailSentStatus) == len(orderDetailModels) {
-		status = "ForwardedEntirely"
-	} else {
-		status = "ForwardedPartially"
+	var details []OrderDetailResult
+	for _, item := range orderDetails {
+		if item.Status != models.OrderDetailCancelled {
+			details = append(details, item)
+		}
+	}
+	renderedMessage, errRenderingMessage := models.RenderMessage("vendor_order.txt", gin.H{
+		"Vendor":  orderDetails[0].VendorName,
+		"Order":   order,
+		"Details": details,
+	})
+	if errRenderingMessage != nil {
+		c.JSON(500, gin.H{
+			"status":      "failed",
+			"errors":      errRenderingMessage.Error(),
+			"result":      nil,
+			"description": "Gagal menyusun notifikasi order untuk vendor.",
+		})
+		return
+	}
+	message := renderedMessage.Body
+
+	// send the order straight to the telegram chat of the vendor when there is one
+	// fall back to a whatsapp link for the admin to open otherwise
+	var channel = models.ChannelWhatsapp
+	var errSendingMessage error
+	var whatsappAPI = ""
+	if vendor.VendorTelegramID != "" {
+		channel = models.ChannelTelegram
+		_, errSendingMessage = services.SendTelegramWithButtons(message, vendor.VendorTelegramID, vendorOrderButtons(order.ID, vendor.ID))
+		if errSendingMessage != nil {
+			// still give the admin a link when the vendor has a usable phone number
+			vendorPhoneNumber, _ = utils.SanitizePhoneNumber(orderDetails[0].VendorPhone)
+		}
+	}
+	if vendorPhoneNumber != "" {
+		whatsappAPI = "https://api.whatsapp.com/send/?phone=" + vendorPhoneNumber + "&text=" + url.QueryEscape(message)
+		whatsappAPI += "&type=phone_number&app_absent=0"
 	}
 
-	models.UpdateOrder(map[string]interface{}{"id": orderId}, map[string]interface{}{"status": status, "updated_at": time.Now(), "created_by": adminContext.User.Name})
-
-	message := "Ada order untuk " + orderDetails[0].VendorName + " dengan ID #" + orderId + " dari " + order.CustomerName + " di " + order.CustomerUnit
-	message += " pada " + orderedAt + " untuk diantar pada " + orderedFor + " dengan rincian:\n"
-	message += details
+	var messages = []string{}
+	notifications, errRecordingNotification := models.RecordVendorNotification(services.DB, order.ID, vendor.ID, orderDetailIds, channel, errSendingMessage, adminContext.User.Name)
+	if errRecordingNotification != nil {
+		messages = append(messages, "Gagal mencatat notifikasi vendor: "+errRecordingNotification.Error())
+	}
 
-	whatsappAPI := "https://api.whatsapp.com/send/?phone=" + vendorPhoneNumber + "&text=" + url.QueryEscape(message)
-	whatsappAPI += "&type=phone_number&app_absent=0"
+	description := "Berhasil menyusun notifikasi untuk vendor untuk dikirim via Whatsapp."
+	if channel == models.ChannelTelegram {
+		description = "Berhasil mengirim notifikasi order ke vendor via Telegram."
+		if errSendingMessage != nil {
+			messages = append(messages, "Gagal mengirim notifikasi via Telegram: "+errSendingMessage.Error())
+			description = "Gagal mengirim notifikasi order ke vendor via Telegram, order sudah berstatus Sent dan perlu dikabarkan ke vendor secara manual."
+		}
+	}
 
 	c.JSON(200, gin.H{
 		"status": "success",
 		"result": map[string]interface{}{
-			"order":       order,
-			"details":     orderDetails,
-			"messageLink": whatsappAPI,
+			"order":         order,
+			"details":       orderDetails,
+			"channel":       channel,
+			"delivered":     channel == models.ChannelTelegram && errSendingMessage == nil,
+			"messageLink":   whatsappAPI,
+			"notifications": notifications,
 		},
-		"errors":      nil,
-		"description": "Berhasil menyusun notifikasi untuk vendor untuk dikirim via Whatsapp.",
+		"errors":      messages,
+		"description": description,
+	})
+}
+
+// respondOrderMutationError reports an error coming out of an order mutation,
+// telling a rejected status transition apart from a missing row or a failure
+// of the database.
+func respondOrderMutationError(c *gin.Context, err error, description string) {
+	var transitionError models.TransitionError
+	var ruleViolationError models.RuleViolationError
+	code := 512
+	var errs interface{} = err.Error()
+	if errors.As(err, &transitionError) {
+		code = 422
+	} else if errors.As(err, &ruleViolationError) {
+		// the violations are listed one by one so they can be shown, and
+		// the request repeated with an override_reason to go ahead anyway
+		code = 422
+		errs = ruleViolationError.Violations
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		code = 404
+	}
+	c.JSON(code, gin.H{
+		"status":      "failed",
+		"errors":      errs,
+		"result":      nil,
+		"description": description,
 	})
 }
 
+// ruleOverrideData is what the rule_override block of the templates shows
+// about the ordering rules overridden by a change, if any.
+func ruleOverrideData(violations []models.RuleViolation, reason string) gin.H {
+	return gin.H{"Violations": violations, "Reason": reason}
+}
+
 type ChangeOrderMenuUri struct {
-	orderDetailId int `uri:"orderDetailId" binding:"required"`
-	menuId        int `uri:"menuId" binding:"required"`
+	OrderDetailId int `uri:"orderDetailId" binding:"required"`
+	MenuId        int `uri:"menuId" binding:"required"`
+}
+
+// RuleOverrideInput lets an admin go ahead with a change which breaks the
+// ordering rules of a menu or vendor. The reason is recorded with the change.
+type RuleOverrideInput struct {
+	OverrideReason string `json:"override_reason"`
 }
 
 func ChangeMenuInAnOrder(c *gin.Context) {
@@ -181,8 +297,19 @@ func ChangeMenuInAnOrder(c *gin.Context) {
 		})
 		return
 	}
-	orderDetailId := uri.orderDetailId
-	menuId := uri.menuId
+	// the body is optional, it only carries an override of the ordering rules
+	var override RuleOverrideInput
+	if err := c.ShouldBindJSON(&override); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak bisa mengolah data dari JSON yang ada: " + err.Error(),
+			"result":      nil,
+			"description": "JSON yang ada tidak sesuai dengan ketentuan.",
+		})
+		return
+	}
+	orderDetailId := uri.OrderDetailId
+	menuId := uri.MenuId
 	adminContext := c.MustGet("admin").(models.Admin)
 
 	var orderDetail models.OrderDetail
@@ -191,7 +318,7 @@ func ChangeMenuInAnOrder(c *gin.Context) {
 	var menu models.Menu
 	menuQuery := services.DB.Where("id", menuId).First(&menu)
 
-	if orderDetailQuery.RowsAffected == 0 && menuQuery.RowsAffected == 0 {
+	if orderDetailQuery.RowsAffected == 0 || menuQuery.RowsAffected == 0 {
 		c.JSON(400, gin.H{
 			"status":      "failed",
 			"errors":      "Tidak ada data pada salah satu atau keduanya dari detail order maupun menu dengan ID tersebut.",
@@ -201,6 +328,16 @@ func ChangeMenuInAnOrder(c *gin.Context) {
 		return
 	}
 
+	if orderDetail.Status.IsFinal() {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Detail order sudah berstatus " + string(orderDetail.Status) + ".",
+			"result":      nil,
+			"description": "Tidak dapat mengganti menu pada detail order yang sudah tidak dapat diubah.",
+		})
+		return
+	}
+
 	// get price and COGS of the replacing menu
 	// update the order detail
 	// update the order amount
@@ -210,30 +347,34 @@ func ChangeMenuInAnOrder(c *gin.Context) {
 	newMenuName := menu.Name
 	newMenuPrice := menu.RetailPrice
 	newMenuCOGS := menu.COGS
-	models.UpdateOrderDetail(map[string]interface{}{"id": orderDetailId}, map[string]interface{}{"menu_id": menuId, "price": newMenuPrice, "cogs": newMenuCOGS, "created_by": adminContext.User.Name, "updated_at": time.Now()})
-
-	var orderDetails []models.OrderDetail
-	var newAmount int
-	orderQuery := services.DB.Where("order_id", orderId).Find(&orderDetails)
-	if orderQuery.Error != nil {
-		c.JSON(400, gin.H{
-			"status":      "failed",
-			"errors":      orderQuery.Error.Error(),
-			"result":      nil,
-			"description": "Tidak dapat mengambil data order dari order ID pada detail order yang sudah ditentukan.",
-		})
-		return
-	}
-	for _, i := range orderDetails {
-		if i.Status != "Cancelled" {
-			newAmount += int(i.Price) * int(i.Qty)
+	var violations []models.RuleViolation
+	errChangingMenu := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		violations, err = models.CheckOrderLineChange(tx, orderId, orderDetail.ID, menu.ID, orderDetail.Qty)
+		if err != nil {
+			return err
+		}
+		if err := models.CheckRuleOverride(tx, orderId, orderDetail.ID, violations, override.OverrideReason, adminContext.User.Name); err != nil {
+			return err
+		}
+		if err := models.UpdateOrderDetail(tx, map[string]interface{}{"id": orderDetailId}, map[string]interface{}{"menu_id": menuId, "price": newMenuPrice, "cogs": newMenuCOGS, "created_by": adminContext.User.Name, "updated_at": time.Now()}); err != nil {
+			return err
 		}
+		_, err = models.RecountOrder(tx, orderId, adminContext.User.Name)
+		return err
+	})
+	if errChangingMenu != nil {
+		respondOrderMutationError(c, errChangingMenu, "Gagal mengganti menu dan memperbarui jumlah order.")
+		return
 	}
-	models.UpdateOrder(map[string]interface{}{"id": orderId}, map[string]interface{}{"amount": newAmount, "updated_at": time.Now(), "created_by": adminContext.User.Name})
 
-	orderID := strconv.Itoa(int(orderId))
-	var telegramMessage string = "Menu " + oldMenuName + " pada order ID #" + orderID + " diganti menjadi " + newMenuName + " oleh " + adminContext.User.Name
-	go services.SendTelegramToGroup(telegramMessage)
+	models.NotifyGroupTemplate("order_menu_changed.txt", gin.H{
+		"OrderID":  orderId,
+		"OldMenu":  oldMenuName,
+		"NewMenu":  newMenuName,
+		"Admin":    adminContext.User.Name,
+		"Override": ruleOverrideData(violations, override.OverrideReason),
+	})
 
 	c.JSON(200, gin.H{
 		"status":      "success",
@@ -248,7 +389,8 @@ type ChangeOrderDetailUri struct {
 }
 
 type ChangeOrderMenuQty struct {
-	Qty uint `json:"qty"`
+	Qty uint `json:"qty" binding:"required,min=1"`
+	RuleOverrideInput
 }
 
 func ChangeQtyOfAMenuInAnOrder(c *gin.Context) {
@@ -290,40 +432,51 @@ func ChangeQtyOfAMenuInAnOrder(c *gin.Context) {
 		return
 	}
 
+	if orderDetail.Status.IsFinal() {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Detail order sudah berstatus " + string(orderDetail.Status) + ".",
+			"result":      nil,
+			"description": "Tidak dapat mengubah jumlah menu pada detail order yang sudah tidak dapat diubah.",
+		})
+		return
+	}
+
 	orderId := orderDetail.Order.ID
 	menuName := orderDetail.Menu.Name
 	menuQty := orderDetail.Qty
 	// update the menu qty
 	// update the order amount and num_of_qty
 	// notify the telegram group
-	models.UpdateOrderDetail(map[string]interface{}{"id": orderDetailId}, map[string]interface{}{"qty": qty.Qty, "updated_at": time.Now(), "created_by": adminContext.User.Name})
-
-	var orderDetails []models.OrderDetail
-	var newAmount int
-	var newQtyOfMenus int
-	orderQuery := services.DB.Where("order_id", orderId).Find(&orderDetails)
-	if orderQuery.Error != nil {
-		c.JSON(400, gin.H{
-			"status":      "failed",
-			"errors":      orderQuery.Error.Error(),
-			"result":      nil,
-			"description": "Tidak dapat mengambil data order dari order ID pada detail order yang sudah ditentukan.",
-		})
-		return
-	}
-	for _, i := range orderDetails {
-		if i.Status != "Cancelled" {
-			newAmount += int(i.Price) * int(i.Qty)
-			newQtyOfMenus += int(i.Qty)
+	var violations []models.RuleViolation
+	errChangingQty := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		violations, err = models.CheckOrderLineChange(tx, orderId, orderDetail.ID, orderDetail.MenuID, qty.Qty)
+		if err != nil {
+			return err
+		}
+		if err := models.CheckRuleOverride(tx, orderId, orderDetail.ID, violations, qty.OverrideReason, adminContext.User.Name); err != nil {
+			return err
+		}
+		if err := models.UpdateOrderDetail(tx, map[string]interface{}{"id": orderDetailId}, map[string]interface{}{"qty": qty.Qty, "updated_at": time.Now(), "created_by": adminContext.User.Name}); err != nil {
+			return err
 		}
+		_, err = models.RecountOrder(tx, orderId, adminContext.User.Name)
+		return err
+	})
+	if errChangingQty != nil {
+		respondOrderMutationError(c, errChangingQty, "Gagal mengubah jumlah menu dan memperbarui jumlah order.")
+		return
 	}
-	models.UpdateOrder(map[string]interface{}{"id": orderId}, map[string]interface{}{"amount": newAmount, "qty_of_menus": newQtyOfMenus, "updated_at": time.Now(), "created_by": adminContext.User.Name})
 
-	orderID := strconv.Itoa(int(orderId))
-	oldQty := strconv.Itoa(int(menuQty))
-	newQty := strconv.Itoa(int(qty.Qty))
-	telegramMessage := "Jumlah menu " + menuName + " pada order ID #" + orderID + " diganti dari " + oldQty + " porsi menjadi " + newQty + " porsi oleh " + adminContext.User.Name
-	go services.SendTelegramToGroup(telegramMessage)
+	models.NotifyGroupTemplate("order_qty_changed.txt", gin.H{
+		"OrderID":  orderId,
+		"Menu":     menuName,
+		"OldQty":   menuQty,
+		"NewQty":   qty.Qty,
+		"Admin":    adminContext.User.Name,
+		"Override": ruleOverrideData(violations, qty.OverrideReason),
+	})
 
 	c.JSON(200, gin.H{
 		"status":      "success",
@@ -380,11 +533,18 @@ func ChangeNoteOfAMenuInAnOrder(c *gin.Context) {
 	// notify the telegram group
 	orderId := orderDetail.Order.ID
 	menuName := orderDetail.Menu.Name
-	models.UpdateOrderDetail(map[string]interface{}{"id": orderDetailId}, map[string]interface{}{"note": note.Note, "updated_at": time.Now(), "created_by": adminContext.User.Name})
+	errChangingNote := models.UpdateOrderDetail(services.DB, map[string]interface{}{"id": orderDetailId}, map[string]interface{}{"note": note.Note, "updated_at": time.Now(), "created_by": adminContext.User.Name})
+	if errChangingNote != nil {
+		respondOrderMutationError(c, errChangingNote, "Gagal mengubah catatan menu pada detail order.")
+		return
+	}
 
-	orderID := strconv.Itoa(int(orderId))
-	telegramMessage := "Catatan pada menu " + menuName + " pada order ID #" + orderID + " diubah menjadi: " + note.Note + ", oleh " + adminContext.User.Name
-	go services.SendTelegramToGroup(telegramMessage)
+	models.NotifyGroupTemplate("order_note_changed.txt", gin.H{
+		"OrderID": orderId,
+		"Menu":    menuName,
+		"Note":    note.Note,
+		"Admin":   adminContext.User.Name,
+	})
 
 	c.JSON(200, gin.H{
 		"status":      "success",
@@ -395,8 +555,8 @@ func ChangeNoteOfAMenuInAnOrder(c *gin.Context) {
 }
 
 type ChangeOrderMenuStatus struct {
-	Status string `json:"status" binding:"required"`
-	Note   string `json:"note" binding:"required_if=Status Cancelled"`
+	Status models.OrderDetailStatus `json:"status" binding:"required,oneof=Sent Accepted Ready Delivered Cancelled"`
+	Note   string                   `json:"note" binding:"required_if=Status Cancelled"`
 }
 
 func ChangeStatusOfAMenuInAnOrder(c *gin.Context) {
@@ -448,57 +608,41 @@ func ChangeStatusOfAMenuInAnOrder(c *gin.Context) {
 	// notify the telegram group
 	orderId := orderDetail.Order.ID
 	menuName := orderDetail.Menu.Name
-	orderID := strconv.Itoa(int(orderId))
-	orderDetailTelegramMessage := "Status pada menu " + menuName + " pada order ID #" + orderID + " diubah menjadi: " + status.Status
 	updatedOrderDetail := map[string]interface{}{
-		"status":     status.Status,
 		"updated_at": time.Now(),
 		"created_by": adminContext.User.Name,
 	}
-	if status.Status == "Cancelled" {
+	if status.Status == models.OrderDetailCancelled {
 		updatedOrderDetail["reason_for_cancellation"] = status.Note
-		orderDetailTelegramMessage += " karena: " + status.Note
 	}
-	models.UpdateOrderDetail(map[string]interface{}{"id": orderDetailId}, updatedOrderDetail)
-	orderDetailTelegramMessage += ", oleh " + adminContext.User.Name
-
-	var orderDetails []models.OrderDetail
-	var newAmount int
-	var newQtyOfMenus int
-	var newNumOfMenus int = 0
-	orderQuery := services.DB.Where("order_id", orderId).Find(&orderDetails)
-	if orderQuery.Error != nil {
-		c.JSON(400, gin.H{
-			"status":      "failed",
-			"errors":      orderQuery.Error.Error(),
-			"result":      nil,
-			"description": "Tidak dapat mengambil data order dari order ID pada detail order yang sudah ditentukan.",
-		})
+	var order models.Order
+	errChangingStatus := services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := models.TransitionOrderDetail(tx, map[string]interface{}{"id": orderDetailId}, status.Status, updatedOrderDetail); err != nil {
+			return err
+		}
+		var err error
+		order, err = models.RecountOrder(tx, orderId, "Itsfood Administration Service")
+		return err
+	})
+	if errChangingStatus != nil {
+		respondOrderMutationError(c, errChangingStatus, "Status detail order tidak dapat diubah menjadi status yang dimaksud.")
 		return
 	}
-	for _, i := range orderDetails {
-		if i.Status != "Cancelled" {
-			newAmount += int(i.Price) * int(i.Qty)
-			newQtyOfMenus += int(i.Qty)
-			newNumOfMenus += 1
-		}
+	var reason = ""
+	if status.Status == models.OrderDetailCancelled {
+		reason = status.Note
 	}
+	models.NotifyGroupTemplate("order_detail_status_changed.txt", gin.H{
+		"OrderID": orderId,
+		"Menu":    menuName,
+		"Status":  status.Status,
+		"Reason":  reason,
+		"Admin":   adminContext.User.Name,
+	})
 
-	go services.SendTelegramToGroup(orderDetailTelegramMessage)
-
-	updatedOrder := map[string]interface{}{
-		"amount":       newAmount,
-		"num_of_menus": newNumOfMenus,
-		"qty_of_menus": newQtyOfMenus,
-		"updated_at":   time.Now(),
-		"created_by":   "Itsfood Administration Service",
+	if order.Status == models.OrderCancelled {
+		models.NotifyGroupTemplate("order_auto_cancelled.txt", gin.H{"OrderID": orderId})
 	}
-	if newNumOfMenus == 0 {
-		updatedOrder["status"] = "Cancelled"
-		orderTelegramMessage := "Order dengan ID #" + orderID + " telah batal otomatis."
-		go services.SendTelegramToGroup(orderTelegramMessage)
-	}
-	models.UpdateOrder(map[string]interface{}{"id": orderId}, updatedOrder)
 
 	c.JSON(200, gin.H{
 		"status":      "success",
@@ -514,6 +658,34 @@ type AddMenuCostOrDiscount struct {
 	Issuer string `json:"issuer"`
 }
 
+// defaultLargeAdjustmentAmount is used when LARGE_ADJUSTMENT_AMOUNT is not set.
+const defaultLargeAdjustmentAmount = 100000
+
+// isLargeAdjustment tells whether a cost or discount is big enough to need
+// the permission of the finance role, being above LARGE_ADJUSTMENT_AMOUNT.
+func isLargeAdjustment(amount uint) bool {
+	threshold, err := strconv.ParseUint(os.Getenv("LARGE_ADJUSTMENT_AMOUNT"), 10, 64)
+	if err != nil {
+		threshold = defaultLargeAdjustmentAmount
+	}
+	return uint64(amount) > threshold
+}
+
+// allowAdjustment answers 403 and tells false when the admin may not add a
+// cost or discount of amount.
+func allowAdjustment(c *gin.Context, amount uint) bool {
+	if !isLargeAdjustment(amount) || c.MustGet("permissions").(models.PermissionSet).Has(models.PermissionPricingLarge) {
+		return true
+	}
+	c.JSON(403, gin.H{
+		"status":      "failed",
+		"errors":      "Admin ini tidak memiliki hak akses " + models.PermissionPricingLarge + ".",
+		"result":      nil,
+		"description": "Biaya atau diskon sebesar ini hanya dapat ditambahkan oleh admin dengan role finance.",
+	})
+	return false
+}
+
 func AddCostToAnOrder(c *gin.Context) {
 	runtime.GOMAXPROCS(2)
 	var uri ChangeOrderDetailUri
@@ -521,14 +693,25 @@ func AddCostToAnOrder(c *gin.Context) {
 	errBindingUri := c.ShouldBindUri(&uri)
 	errBindingJSON := c.ShouldBindJSON(&cost)
 	if errBindingUri != nil || errBindingJSON != nil {
+		var uriBindingError string = ""
+		if errBindingUri != nil {
+			uriBindingError += errBindingUri.Error()
+		}
+		var JSONBindingError string = ""
+		if errBindingJSON != nil {
+			JSONBindingError += errBindingJSON.Error()
+		}
 		c.JSON(400, gin.H{
 			"status":      "failed",
-			"errors":      "Tidak bisa mengolah data dari URI maupun JSON yang ada: " + errBindingUri.Error() + " | " + errBindingJSON.Error(),
+			"errors":      "Tidak bisa mengolah data dari URI maupun JSON yang ada: " + uriBindingError + " | " + JSONBindingError,
 			"result":      nil,
 			"description": "URI maupun JSON yang ada tidak sesuai dengan ketentuan.",
 		})
 		return
 	}
+	if !allowAdjustment(c, cost.Amount) {
+		return
+	}
 	orderDetailId := c.Param("orderDetailId")
 	adminContext := c.MustGet("admin").(models.Admin)
 
@@ -546,7 +729,6 @@ func AddCostToAnOrder(c *gin.Context) {
 	}
 
 	orderDetailID, _ := strconv.ParseUint(string(orderDetailId), 10, 64)
-	amount := strconv.Itoa(int(cost.Amount))
 	orderId := orderDetail.Order.ID
 	menuName := orderDetail.Menu.Name
 	newCost := models.Cost{
@@ -558,20 +740,25 @@ func AddCostToAnOrder(c *gin.Context) {
 		CreatedAt:     time.Now(),
 		CreatedBy:     adminContext.User.Name,
 	}
-	insertNewCost := services.DB.Create(&newCost)
-	if insertNewCost.Error != nil {
-		c.JSON(512, gin.H{
-			"status":      "failed",
-			"errors":      insertNewCost.Error.Error(),
-			"result":      nil,
-			"description": "Gagal menyimpan biaya yang disi.",
-		})
+	errInsertingCost := services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&newCost).Error; err != nil {
+			return err
+		}
+		_, err := models.RecountOrder(tx, orderId, adminContext.User.Name)
+		return err
+	})
+	if errInsertingCost != nil {
+		respondOrderMutationError(c, errInsertingCost, "Gagal menyimpan biaya yang diisi.")
 		return
 	}
 
-	orderID := strconv.Itoa(int(orderId))
-	telegramMessage := "Ada biaya sebesar Rp" + amount + " ditambahkan dengan keterangan: " + cost.Reason + ", pada menu " + menuName + " di order ID #" + orderID + " oleh " + adminContext.User.Name
-	go services.SendTelegramToGroup(telegramMessage)
+	models.NotifyGroupTemplate("order_cost_added.txt", gin.H{
+		"OrderID": orderId,
+		"Menu":    menuName,
+		"Amount":  cost.Amount,
+		"Reason":  cost.Reason,
+		"Admin":   adminContext.User.Name,
+	})
 
 	c.JSON(200, gin.H{
 		"status":      "success",
@@ -588,14 +775,25 @@ func AddDiscountToAnOrder(c *gin.Context) {
 	errBindingUri := c.ShouldBindUri(&uri)
 	errBindingJSON := c.ShouldBindJSON(&discount)
 	if errBindingUri != nil || errBindingJSON != nil {
+		var uriBindingError string = ""
+		if errBindingUri != nil {
+			uriBindingError += errBindingUri.Error()
+		}
+		var JSONBindingError string = ""
+		if errBindingJSON != nil {
+			JSONBindingError += errBindingJSON.Error()
+		}
 		c.JSON(400, gin.H{
 			"status":      "failed",
-			"errors":      "Tidak bisa mengolah data dari URI maupun JSON yang ada: " + errBindingUri.Error() + " | " + errBindingJSON.Error(),
+			"errors":      "Tidak bisa mengolah data dari URI maupun JSON yang ada: " + uriBindingError + " | " + JSONBindingError,
 			"result":      nil,
 			"description": "URI maupun JSON yang ada tidak sesuai dengan ketentuan.",
 		})
 		return
 	}
+	if !allowAdjustment(c, discount.Amount) {
+		return
+	}
 	orderDetailId := c.Param("orderDetailId")
 	adminContext := c.MustGet("admin").(models.Admin)
 
@@ -613,7 +811,6 @@ func AddDiscountToAnOrder(c *gin.Context) {
 	}
 
 	orderDetailID, _ := strconv.ParseUint(string(orderDetailId), 10, 64)
-	amount := strconv.Itoa(int(discount.Amount))
 	orderId := orderDetail.Order.ID
 	menuName := orderDetail.Menu.Name
 	newDiscount := models.Discount{
@@ -625,26 +822,257 @@ func AddDiscountToAnOrder(c *gin.Context) {
 		CreatedAt:     time.Now(),
 		CreatedBy:     adminContext.User.Name,
 	}
-	insertNewDiscount := services.DB.Create(&newDiscount)
-	if insertNewDiscount.Error != nil {
-		c.JSON(512, gin.H{
+	errInsertingDiscount := services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&newDiscount).Error; err != nil {
+			return err
+		}
+		_, err := models.RecountOrder(tx, orderId, adminContext.User.Name)
+		return err
+	})
+	if errInsertingDiscount != nil {
+		respondOrderMutationError(c, errInsertingDiscount, "Gagal menyimpan diskon yang diisi.")
+		return
+	}
+
+	models.NotifyGroupTemplate("order_discount_added.txt", gin.H{
+		"OrderID": orderId,
+		"Menu":    menuName,
+		"Amount":  discount.Amount,
+		"Reason":  discount.Reason,
+		"Admin":   adminContext.User.Name,
+	})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      nil,
+		"description": "Berhasil menyimpan diskon untuk menu pada detail order yang dimaksud.",
+	})
+}
+
+type AddOrderMenu struct {
+	MenuID uint64 `json:"menu_id" binding:"required"`
+	Qty    uint   `json:"qty" binding:"required,min=1"`
+	Note   string `json:"note"`
+	RuleOverrideInput
+}
+
+func AddMenuToAnOrder(c *gin.Context) {
+	var menuToAdd AddOrderMenu
+	if err := c.ShouldBindJSON(&menuToAdd); err != nil {
+		c.JSON(400, gin.H{
 			"status":      "failed",
-			"errors":      insertNewDiscount.Error.Error(),
+			"errors":      "Tidak bisa mengolah data dari JSON yang ada: " + err.Error(),
 			"result":      nil,
-			"description": "Gagal menyimpan diskon yang disi.",
+			"description": "JSON yang ada tidak sesuai dengan ketentuan.",
 		})
 		return
 	}
+	orderId, notValidId := strconv.ParseUint(c.Param("orderId"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengambil data order",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
 
-	orderID := strconv.Itoa(int(orderId))
-	telegramMessage := "Ada diskon sebesar Rp" + amount + " ditambahkan dengan keterangan: " + discount.Reason + ", pada menu " + menuName + " di order ID #" + orderID + " oleh " + adminContext.User.Name
-	go services.SendTelegramToGroup(telegramMessage)
+	var order models.Order
+	orderQuery := services.DB.First(&order, orderId)
+	if orderQuery.Error != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      orderQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan order dengan ID yang dimaksud.",
+		})
+		return
+	}
+	if order.Status.IsFinal() {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Order sudah berstatus " + string(order.Status) + ".",
+			"result":      nil,
+			"description": "Tidak dapat menambah menu pada order yang sudah batal atau selesai.",
+		})
+		return
+	}
+
+	var menu models.Menu
+	menuQuery := services.DB.First(&menu, menuToAdd.MenuID)
+	if menuQuery.Error != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      menuQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan menu dengan ID yang dimaksud.",
+		})
+		return
+	}
+
+	// add the menu with its current price and COGS
+	// update order amount, num_of_menus, & qty_of_menus
+	// notify the telegram group
+	orderDetail := models.OrderDetail{
+		OrderID:   order.ID,
+		MenuID:    menu.ID,
+		Qty:       menuToAdd.Qty,
+		Price:     uint64(menu.RetailPrice),
+		COGS:      uint64(menu.COGS),
+		Note:      menuToAdd.Note,
+		Status:    models.OrderDetailCreated,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		CreatedBy: adminContext.User.Name,
+	}
+	var violations []models.RuleViolation
+	errAddingMenu := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		violations, err = models.CheckOrderLineChange(tx, order.ID, 0, menu.ID, menuToAdd.Qty)
+		if err != nil {
+			return err
+		}
+		if err := models.CreateOrderDetail(tx, &orderDetail); err != nil {
+			return err
+		}
+		if err := models.CheckRuleOverride(tx, order.ID, orderDetail.ID, violations, menuToAdd.OverrideReason, adminContext.User.Name); err != nil {
+			return err
+		}
+		_, err = models.RecountOrder(tx, order.ID, adminContext.User.Name)
+		return err
+	})
+	if errAddingMenu != nil {
+		respondOrderMutationError(c, errAddingMenu, "Gagal menyimpan menu baru pada order ini.")
+		return
+	}
+
+	models.NotifyGroupTemplate("order_menu_added.txt", gin.H{
+		"OrderID":  order.ID,
+		"Menu":     menu.Name,
+		"Qty":      menuToAdd.Qty,
+		"Admin":    adminContext.User.Name,
+		"Override": ruleOverrideData(violations, menuToAdd.OverrideReason),
+	})
+
+	c.JSON(201, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      orderDetail,
+		"description": "Berhasil menambah menu pada order yang dimaksud.",
+	})
+}
+
+type RemoveOrderMenu struct {
+	Reason string `json:"reason"`
+	RuleOverrideInput
+}
+
+func RemoveMenuFromAnOrder(c *gin.Context) {
+	var uri ChangeOrderDetailUri
+	var removal RemoveOrderMenu
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak bisa mengolah data dari URI yang ada: " + err.Error(),
+			"result":      nil,
+			"description": "URI yang ada tidak sesuai dengan ketentuan.",
+		})
+		return
+	}
+	// the reason is optional, so an empty body is fine
+	_ = c.ShouldBindJSON(&removal)
+	orderDetailId := c.Param("orderDetailId")
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var orderDetail models.OrderDetail
+	orderDetailQuery := services.DB.Preload("Menu").Preload("Costs").Preload("Discounts").Where("id", orderDetailId).First(&orderDetail)
+	if orderDetailQuery.Error != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      orderDetailQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengambil data detail order dari ID yang diberikan.",
+		})
+		return
+	}
+	if orderDetail.Status.IsFinal() {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Detail order sudah berstatus " + string(orderDetail.Status) + ".",
+			"result":      nil,
+			"description": "Tidak dapat menghapus menu yang sudah batal atau sudah diantar.",
+		})
+		return
+	}
+
+	// a line which has been sent to the vendor or has costs/discounts attached
+	// is voided instead of deleted so nothing referring to it is lost
+	orderId := orderDetail.OrderID
+	menuName := orderDetail.Menu.Name
+	voided := orderDetail.Status != models.OrderDetailCreated || len(orderDetail.Costs) > 0 || len(orderDetail.Discounts) > 0
+	if voided && removal.Reason == "" {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Alasan pembatalan wajib diisi.",
+			"result":      nil,
+			"description": "Menu yang sudah dikirim ke vendor atau memiliki biaya/diskon hanya dapat dibatalkan dengan alasan.",
+		})
+		return
+	}
+
+	// the vendor left with the other lines is still held to its minimums
+	var order models.Order
+	var violations []models.RuleViolation
+	errRemovingMenu := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		violations, err = models.CheckOrderLineRemoval(tx, orderId, orderDetail.ID)
+		if err != nil {
+			return err
+		}
+		if err := models.CheckRuleOverride(tx, orderId, orderDetail.ID, violations, removal.OverrideReason, adminContext.User.Name); err != nil {
+			return err
+		}
+		if voided {
+			err = models.TransitionOrderDetail(tx, map[string]interface{}{"id": orderDetailId}, models.OrderDetailCancelled, map[string]interface{}{
+				"reason_for_cancellation": removal.Reason,
+				"updated_at":              time.Now(),
+				"created_by":              adminContext.User.Name,
+			})
+		} else {
+			err = models.DeleteOrderDetail(tx, map[string]interface{}{"id": orderDetailId}, adminContext.User.Name)
+		}
+		if err != nil {
+			return err
+		}
+		order, err = models.RecountOrder(tx, orderId, adminContext.User.Name)
+		return err
+	})
+	if errRemovingMenu != nil {
+		respondOrderMutationError(c, errRemovingMenu, "Menu pada detail order ini tidak dapat dihapus atau dibatalkan.")
+		return
+	}
+
+	models.NotifyGroupTemplate("order_menu_removed.txt", gin.H{
+		"OrderID":  orderId,
+		"Menu":     menuName,
+		"Voided":   voided,
+		"Reason":   removal.Reason,
+		"Admin":    adminContext.User.Name,
+		"Override": ruleOverrideData(violations, removal.OverrideReason),
+	})
+
+	if order.Status == models.OrderCancelled {
+		models.NotifyGroupTemplate("order_auto_cancelled.txt", gin.H{"OrderID": orderId})
+	}
 
 	c.JSON(200, gin.H{
 		"status":      "success",
 		"errors":      nil,
-		"result":      nil,
-		"description": "Berhasil menyimpan diskon untuk menu pada detail order yang dimaksud.",
+		"result":      map[string]interface{}{"voided": voided},
+		"description": "Berhasil menghapus menu dari order yang dimaksud.",
 	})
 }
 
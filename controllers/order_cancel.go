@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+type CancelOrderInput struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+func CancelOrder(c *gin.Context) {
+	var input CancelOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Alasan pembatalan order wajib diisi.",
+		})
+		return
+	}
+	orderId, notValidId := strconv.ParseUint(c.Param("orderId"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengambil data order",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var order models.Order
+	orderQuery := services.DB.Preload("Customer.User").Preload("Customer.Unit").First(&order, orderId)
+	if orderQuery.Error != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      orderQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan order dengan ID yang dimaksud.",
+		})
+		return
+	}
+	if order.Status.IsFinal() {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Order sudah berstatus " + string(order.Status) + ".",
+			"result":      nil,
+			"description": "Tidak dapat membatalkan order yang sudah batal atau selesai.",
+		})
+		return
+	}
+
+	var orderDetails []models.OrderDetail
+	orderDetailsQuery := services.DB.Preload("Menu.Vendor.User").
+		Where("order_id = ?", orderId).
+		Where("status != ?", models.OrderDetailCancelled).
+		Find(&orderDetails)
+	if orderDetailsQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      orderDetailsQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query order details.",
+		})
+		return
+	}
+
+	// cancel every remaining detail with the same reason
+	// let the recount zero the totals and cancel the order itself
+	// notify the telegram group once, and every vendor who already got the order
+	var orderDetailIds []uint64
+	for _, item := range orderDetails {
+		orderDetailIds = append(orderDetailIds, item.ID)
+	}
+	errCancellingOrder := services.DB.Transaction(func(tx *gorm.DB) error {
+		if len(orderDetailIds) > 0 {
+			err := models.TransitionOrderDetail(tx, map[string]interface{}{"id": orderDetailIds}, models.OrderDetailCancelled, map[string]interface{}{
+				"reason_for_cancellation": input.Reason,
+				"updated_at":              time.Now(),
+				"created_by":              adminContext.User.Name,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		_, err := models.RecountOrder(tx, order.ID, adminContext.User.Name)
+		return err
+	})
+	if errCancellingOrder != nil {
+		respondOrderMutationError(c, errCancellingOrder, "Gagal membatalkan order beserta detail order-nya.")
+		return
+	}
+
+	type VendorToNotify struct {
+		ID      uint64 `json:"id"`
+		Name    string `json:"name"`
+		Channel string `json:"channel"`
+		Link    string `json:"link"`
+		vendor  models.Vendor
+		details []models.OrderDetail
+	}
+	var vendorsToNotify []VendorToNotify
+	vendorIndex := map[uint64]int{}
+	for _, item := range orderDetails {
+		if !item.Status.IsWithVendor() {
+			continue
+		}
+		vendor := item.Menu.Vendor
+		i, ok := vendorIndex[vendor.ID]
+		if !ok {
+			vendorsToNotify = append(vendorsToNotify, VendorToNotify{ID: vendor.ID, Name: vendor.User.Name, vendor: vendor})
+			i = len(vendorsToNotify) - 1
+			vendorIndex[vendor.ID] = i
+		}
+		vendorsToNotify[i].details = append(vendorsToNotify[i].details, item)
+	}
+
+	for i := range vendorsToNotify {
+		vendorToNotify := &vendorsToNotify[i]
+		message, err := models.RenderMessage("order_cancelled_vendor.txt", gin.H{
+			"Order":    order,
+			"Customer": order.Customer,
+			"Reason":   input.Reason,
+			"Details":  vendorToNotify.details,
+		})
+		if err != nil {
+			log.Print("Failed to render the cancellation message for vendor ", vendorToNotify.Name, ": ", err.Error())
+			continue
+		}
+		if vendorToNotify.vendor.VendorTelegramID != "" {
+			vendorToNotify.Channel = "Telegram"
+			models.Notify(services.ChannelTelegram, vendorToNotify.vendor.VendorTelegramID, "", message.Body)
+		} else if vendorPhoneNumber, err := utils.SanitizePhoneNumber(vendorToNotify.vendor.Phone); err == nil {
+			vendorToNotify.Channel = "Whatsapp"
+			vendorToNotify.Link = "https://api.whatsapp.com/send/?phone=" + vendorPhoneNumber + "&text=" + url.QueryEscape(message.Body) + "&type=phone_number&app_absent=0"
+		}
+	}
+
+	models.NotifyGroupTemplate("order_cancelled.txt", gin.H{
+		"Order":    order,
+		"Customer": order.Customer,
+		"Admin":    adminContext.User.Name,
+		"Reason":   input.Reason,
+		"Details":  orderDetails,
+		"Vendors":  vendorsToNotify,
+	})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"vendors": vendorsToNotify},
+		"description": "Berhasil membatalkan order yang dimaksud.",
+	})
+}
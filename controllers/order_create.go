@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+	"golang.org/x/exp/slices"
+)
+
+type CreateOrderMenu struct {
+	MenuID uint64 `json:"menu_id" binding:"required"`
+	Qty    uint   `json:"qty" binding:"required,min=1"`
+	Note   string `json:"note"`
+}
+
+type CreateOrderInput struct {
+	CustomerID    uint64            `json:"customer_id" binding:"required"`
+	OrderedFor    time.Time         `json:"ordered_for" binding:"required"`
+	OrderedTo     string            `json:"ordered_to" binding:"required"`
+	Purpose       string            `json:"purpose" binding:"required"`
+	Activity      string            `json:"activity" binding:"required"`
+	SourceOfFund  string            `json:"source_of_fund" binding:"required"`
+	PaymentOption string            `json:"payment_option"`
+	Info          string            `json:"info"`
+	Menus         []CreateOrderMenu `json:"menus" binding:"required,min=1,dive"`
+	RuleOverrideInput
+}
+
+func CreateOrder(c *gin.Context) {
+	var input CreateOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var customer models.Customer
+	customerQuery := services.DB.Preload("User").Preload("Unit").First(&customer, input.CustomerID)
+	if customerQuery.Error != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      customerQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan customer dengan ID yang dimaksud.",
+		})
+		return
+	}
+
+	var menuIds []uint64
+	for _, item := range input.Menus {
+		menuIds = append(menuIds, item.MenuID)
+	}
+	var menus []models.Menu
+	menuQuery := services.DB.Preload("Vendor.User").Where("id IN ?", menuIds).Find(&menus)
+	if menuQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      menuQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query menu.",
+		})
+		return
+	}
+	menusById := map[uint64]models.Menu{}
+	for _, menu := range menus {
+		menusById[menu.ID] = menu
+	}
+
+	// snapshot the price and COGS of every menu into its order detail
+	// and count the order amount, num_of_menus & qty_of_menus from them
+	now := time.Now()
+	var orderDetails []models.OrderDetail
+	var amount uint64
+	var qtyOfMenus uint
+	var orderLines []models.OrderLine
+	var vendorIds []uint64
+	for _, item := range input.Menus {
+		menu, ok := menusById[item.MenuID]
+		if !ok {
+			c.JSON(404, gin.H{
+				"status":      "failed",
+				"errors":      "Menu dengan ID " + strconv.Itoa(int(item.MenuID)) + " tidak ditemukan.",
+				"result":      nil,
+				"description": "Gagal menemukan menu dengan ID yang dimaksud.",
+			})
+			return
+		}
+		// the vendor is only loaded for the ordering rules and is left out
+		// of the response
+		detailMenu := menu
+		detailMenu.Vendor = models.Vendor{}
+		orderDetails = append(orderDetails, models.OrderDetail{
+			MenuID:    menu.ID,
+			Menu:      detailMenu,
+			Qty:       item.Qty,
+			Price:     uint64(menu.RetailPrice),
+			COGS:      uint64(menu.COGS),
+			Note:      item.Note,
+			Status:    models.OrderDetailCreated,
+			CreatedAt: now,
+			UpdatedAt: now,
+			CreatedBy: adminContext.User.Name,
+		})
+		amount += uint64(menu.RetailPrice) * uint64(item.Qty)
+		qtyOfMenus += item.Qty
+		orderLines = append(orderLines, models.OrderLine{Menu: menu, Qty: item.Qty, COGS: uint64(menu.COGS), Changed: true})
+		if !slices.Contains(vendorIds, uint64(menu.VendorID)) {
+			vendorIds = append(vendorIds, uint64(menu.VendorID))
+		}
+	}
+	violations := models.ValidateOrderLines(input.OrderedFor, orderLines, vendorIds, now)
+
+	order := models.Order{
+		OrderedBy:     customer.ID,
+		OrderedFor:    input.OrderedFor,
+		OrderedTo:     input.OrderedTo,
+		NumOfMenus:    uint(len(orderDetails)),
+		QtyOfMenus:    qtyOfMenus,
+		Amount:        amount,
+		Purpose:       input.Purpose,
+		Activity:      input.Activity,
+		SourceOfFund:  input.SourceOfFund,
+		PaymentOption: input.PaymentOption,
+		Info:          input.Info,
+		Status:        models.OrderCreated,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		CreatedBy:     adminContext.User.Name,
+	}
+
+	errCreatingOrder := services.DB.Transaction(func(tx *gorm.DB) error {
+		// billing & payment dates stay NULL until they actually happen
+		if err := tx.Omit(clause.Associations, "BilledByVendorAt", "BilledToCustomerAt", "PaidByCustomerAt").Create(&order).Error; err != nil {
+			return err
+		}
+		for i := range orderDetails {
+			orderDetails[i].OrderID = order.ID
+			if err := tx.Omit(clause.Associations).Create(&orderDetails[i]).Error; err != nil {
+				return err
+			}
+		}
+		return models.CheckRuleOverride(tx, order.ID, 0, violations, input.OverrideReason, adminContext.User.Name)
+	})
+	if errCreatingOrder != nil {
+		respondOrderMutationError(c, errCreatingOrder, "Gagal menyimpan data order baru dalam database.")
+		return
+	}
+
+	models.NotifyGroupTemplate("order_created.txt", gin.H{
+		"Order":    order,
+		"Customer": customer,
+		"Details":  orderDetails,
+		"Admin":    adminContext.User.Name,
+		"Override": ruleOverrideData(violations, input.OverrideReason),
+	})
+
+	order.OrderDetail = orderDetails
+	c.JSON(201, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      order,
+		"description": "Berhasil membuat order baru.",
+	})
+}
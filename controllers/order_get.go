@@ -190,43 +190,44 @@ func GetOrder(c *gin.Context) {
 	}
 
 	type OrderDetail struct {
-		ID         uint64      `json:"id"`
-		Qty        uint        `json:"qty"`
-		Price      uint64      `json:"price"`
-		COGS       uint64      `json:"cogs"`
-		Note       string      `json:"note"`
-		Status     string      `json:"status"`
-		CreatedAt  time.Time   `json:"created_at"`
-		UpdatedAt  time.Time   `json:"updated_at"`
-		CreatedBy  string      `json:"created_by"`
-		MenuId     uint64      `json:"menu_id"`
-		MenuName   string      `json:"menu_name"`
-		VendorName string      `json:"vendor_name"`
-		ExtraCosts []ExtraCost `json:"extra_costs"`
-		Discounts  []Discount  `json:"discounts"`
+		ID         uint64                   `json:"id"`
+		Qty        uint                     `json:"qty"`
+		Price      uint64                   `json:"price"`
+		COGS       uint64                   `json:"cogs"`
+		Note       string                   `json:"note"`
+		Status     models.OrderDetailStatus `json:"status"`
+		CreatedAt  time.Time                `json:"created_at"`
+		UpdatedAt  time.Time                `json:"updated_at"`
+		CreatedBy  string                   `json:"created_by"`
+		MenuId     uint64                   `json:"menu_id"`
+		MenuName   string                   `json:"menu_name"`
+		VendorName string                   `json:"vendor_name"`
+		ExtraCosts []ExtraCost              `json:"extra_costs"`
+		Discounts  []Discount               `json:"discounts"`
 	}
 
 	type OrderInformationResult struct {
-		ID             uint64        `json:"id"`
-		OrderedFor     time.Time     `json:"ordered_for"`
-		OrderedTo      string        `json:"ordered_to"`
-		Purpose        string        `json:"purpose"`
-		Activity       string        `json:"activity"`
-		SourceOfFund   string        `json:"source_of_fund"`
-		PaymentOption  string        `json:"payment_option"`
-		Info           string        `json:"info"`
-		Status         string        `json:"status"`
-		CreatedAt      time.Time     `json:"created_at"`
-		UpdatedAt      time.Time     `json:"updated_at"`
-		CreatedBy      string        `json:"created_by"`
-		PurchaseAmount int64         `json:"purchase_amount"`
-		SalesAmount    int64         `json:"sales_amount"`
-		CustomerId     uint64        `json:"customer_id"`
-		CustomerName   string        `json:"customer_name"`
-		CustomerUnit   string        `json:"customer_unit"`
-		CustomerPhone  string        `json:"customer_phone"`
-		CustomerEmail  string        `json:"customer_email"`
-		OrderDetails   []OrderDetail `json:"order_details"`
+		ID             uint64              `json:"id"`
+		OrderedFor     time.Time           `json:"ordered_for"`
+		OrderedTo      string              `json:"ordered_to"`
+		Purpose        string              `json:"purpose"`
+		Activity       string              `json:"activity"`
+		SourceOfFund   string              `json:"source_of_fund"`
+		PaymentOption  string              `json:"payment_option"`
+		Info           string              `json:"info"`
+		Status         models.OrderStatus  `json:"status"`
+		CreatedAt      time.Time           `json:"created_at"`
+		UpdatedAt      time.Time           `json:"updated_at"`
+		CreatedBy      string              `json:"created_by"`
+		PurchaseAmount int64               `json:"purchase_amount"`
+		SalesAmount    int64               `json:"sales_amount"`
+		Pricing        models.OrderPricing `json:"pricing"`
+		CustomerId     uint64              `json:"customer_id"`
+		CustomerName   string              `json:"customer_name"`
+		CustomerUnit   string              `json:"customer_unit"`
+		CustomerPhone  string              `json:"customer_phone"`
+		CustomerEmail  string              `json:"customer_email"`
+		OrderDetails   []OrderDetail       `json:"order_details"`
 	}
 
 	var orderInformation OrderInformationResult
@@ -286,9 +287,6 @@ func GetOrder(c *gin.Context) {
 		return
 	}
 
-	var purchaseAmount int64
-	var salesAmount int64
-
 	var orderDetails []OrderDetail
 
 	for _, od := range orderDetailsRaw {
@@ -297,17 +295,8 @@ func GetOrder(c *gin.Context) {
 		var discounts []Discount
 
 		var orderDetail OrderDetail
-		var totalExtraCost int64
-		var totalVendorExtraCost int64
-		var totalDiscount int64
-		var totalVendorDiscount int64
 
 		for _, cost := range od.Costs {
-			if cost.Issuer == "Vendor" {
-				totalVendorExtraCost += int64(cost.Amount)
-			}
-
-			totalExtraCost += int64(cost.Amount)
 			extraCosts = append(extraCosts, ExtraCost{
 				Amount: uint64(cost.Amount),
 				Reason: cost.Reason,
@@ -316,11 +305,6 @@ func GetOrder(c *gin.Context) {
 		}
 
 		for _, discount := range od.Discounts {
-			if discount.Issuer == "Vendor" {
-				totalVendorDiscount += int64(discount.Amount)
-			} else {
-				totalDiscount += int64(discount.Amount)
-			}
 			discounts = append(discounts, Discount{
 				Amount: uint64(discount.Amount),
 				Reason: discount.Reason,
@@ -345,11 +329,11 @@ func GetOrder(c *gin.Context) {
 
 		orderDetails = append(orderDetails, orderDetail)
 
-		purchaseAmount += (int64(od.COGS) * int64(od.Qty)) + totalVendorExtraCost - totalVendorDiscount
-		salesAmount += (int64(od.Price) * int64(od.Qty)) + totalExtraCost - totalDiscount
-
 	}
 
+	pricing := models.CalculateOrderPricing(orderDetailsRaw)
+	pricing.OrderID = order.ID
+
 	orderInformation.ID = order.ID
 	orderInformation.OrderedFor = order.OrderedFor
 	orderInformation.OrderedTo = order.OrderedTo
@@ -362,8 +346,9 @@ func GetOrder(c *gin.Context) {
 	orderInformation.CreatedAt = order.CreatedAt
 	orderInformation.UpdatedAt = order.UpdatedAt
 	orderInformation.CreatedBy = order.CreatedBy
-	orderInformation.PurchaseAmount = purchaseAmount
-	orderInformation.SalesAmount = salesAmount
+	orderInformation.PurchaseAmount = pricing.NetPurchase
+	orderInformation.SalesAmount = pricing.NetSales
+	orderInformation.Pricing = pricing
 	orderInformation.CustomerId = customer.ID
 	orderInformation.CustomerName = customer.User.Name
 	orderInformation.CustomerUnit = customer.Unit.Name
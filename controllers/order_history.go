@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+func GetOrderHistory(c *gin.Context) {
+	orderId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengambil riwayat order",
+		})
+		return
+	}
+
+	history, err := models.GetOrderHistory(orderId)
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menyusun riwayat perubahan order.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"data": history},
+		"description": "Berhasil mengambil riwayat perubahan order.",
+	})
+}
+
+type RestoreDumpUri struct {
+	DumpId uint64 `uri:"dumpId" binding:"required"`
+}
+
+func RestoreOrder(c *gin.Context) {
+	var uri RestoreDumpUri
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak bisa mengolah data dari URI yang ada: " + err.Error(),
+			"result":      nil,
+			"description": "URI yang ada tidak sesuai dengan ketentuan.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var orderDump models.OrderDump
+	var changes []models.FieldChange
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		orderDump, changes, err = models.RestoreOrder(tx, uri.DumpId, adminContext.User.Name)
+		return err
+	})
+	if err != nil {
+		respondOrderMutationError(c, err, "Gagal mengembalikan order ke versi yang dimaksud.")
+		return
+	}
+
+	if len(changes) > 0 {
+		models.NotifyGroupTemplate("order_restored.txt", gin.H{
+			"OrderID": orderDump.SourceID,
+			"Version": orderDump.UpdatedAt,
+			"Changes": changes,
+			"Admin":   adminContext.User.Name,
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"changes": changes},
+		"description": "Berhasil mengembalikan order ke versi yang dimaksud.",
+	})
+}
+
+func RestoreOrderDetail(c *gin.Context) {
+	var uri RestoreDumpUri
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak bisa mengolah data dari URI yang ada: " + err.Error(),
+			"result":      nil,
+			"description": "URI yang ada tidak sesuai dengan ketentuan.",
+		})
+		return
+	}
+	// the body is optional, it only carries an override of the ordering rules
+	var override RuleOverrideInput
+	_ = c.ShouldBindJSON(&override)
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var orderDetailDump models.OrderDetailDump
+	var changes []models.FieldChange
+	var violations []models.RuleViolation
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		orderDetailDump, changes, violations, err = models.RestoreOrderDetail(tx, uri.DumpId, override.OverrideReason, adminContext.User.Name)
+		return err
+	})
+	if err != nil {
+		respondOrderMutationError(c, err, "Gagal mengembalikan detail order ke versi yang dimaksud.")
+		return
+	}
+
+	if len(changes) > 0 {
+		var menu models.Menu
+		services.DB.First(&menu, orderDetailDump.MenuID)
+		models.NotifyGroupTemplate("order_detail_restored.txt", gin.H{
+			"OrderID":  orderDetailDump.OrderID,
+			"Menu":     menu.Name,
+			"Version":  orderDetailDump.UpdatedAt,
+			"Changes":  changes,
+			"Admin":    adminContext.User.Name,
+			"Override": ruleOverrideData(violations, override.OverrideReason),
+		})
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"changes": changes},
+		"description": "Berhasil mengembalikan detail order ke versi yang dimaksud.",
+	})
+}
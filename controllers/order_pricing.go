@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+type RepairOrderTotalsInput struct {
+	FromID uint64 `json:"from_id" binding:"required"`
+	ToID   uint64 `json:"to_id" binding:"required,gtefield=FromID"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// maxOrdersToRepair keeps a single repair request from locking too many orders.
+const maxOrdersToRepair = 1000
+
+func RepairOrderTotals(c *gin.Context) {
+	var input RepairOrderTotalsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	if input.ToID-input.FromID >= maxOrdersToRepair {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Rentang ID order maksimal " + strconv.Itoa(maxOrdersToRepair) + " order.",
+			"result":      nil,
+			"description": "Rentang ID order yang diberikan terlalu besar.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var orderIds []uint64
+	orderQuery := services.DB.Model(&models.Order{}).
+		Where("id BETWEEN ? AND ?", input.FromID, input.ToID).
+		Order("id").
+		Pluck("id", &orderIds)
+	if orderQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      orderQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query order.",
+		})
+		return
+	}
+
+	// every order is repaired in its own transaction so one failure does not
+	// roll back the orders repaired before it
+	var repairs = []models.OrderTotalsRepair{}
+	var messages = []string{}
+	for _, orderId := range orderIds {
+		err := services.DB.Transaction(func(tx *gorm.DB) error {
+			repair, repaired, err := models.RepairOrderTotals(tx, orderId, adminContext.User.Name, input.DryRun)
+			if err != nil {
+				return err
+			}
+			if repaired {
+				repairs = append(repairs, repair)
+			}
+			return nil
+		})
+		if err != nil {
+			messages = append(messages, "Order ID #"+strconv.Itoa(int(orderId))+": "+err.Error())
+		}
+	}
+
+	description := "Berhasil memperbaiki jumlah order pada rentang ID yang dimaksud."
+	if input.DryRun {
+		description = "Berhasil memeriksa jumlah order pada rentang ID yang dimaksud tanpa menyimpan perubahan."
+	}
+	c.JSON(200, gin.H{
+		"status": "success",
+		"errors": messages,
+		"result": map[string]interface{}{
+			"data":          repairs,
+			"checked_count": len(orderIds),
+			"repair_count":  len(repairs),
+		},
+		"description": description,
+	})
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := services.DB.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengambil daftar role dari database.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"data": roles},
+		"description": "Berhasil mengambil daftar role.",
+	})
+}
+
+// GetMyPermissions lists what the admin of the request may do, for the admin
+// app to hide what it may not.
+func GetMyPermissions(c *gin.Context) {
+	permissions := c.MustGet("permissions").(models.PermissionSet)
+	var names = []string{}
+	for name := range permissions {
+		names = append(names, name)
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"permissions": names},
+		"description": "Berhasil mengambil hak akses admin ini.",
+	})
+}
+
+func GetAdminRoles(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengambil role admin",
+		})
+		return
+	}
+
+	adminRoles, err := models.GetAdminRoles(services.DB, adminId)
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengambil role admin dari database.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"data": adminRoles},
+		"description": "Berhasil mengambil role admin yang dimaksud.",
+	})
+}
+
+type AssignRoleInput struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func AssignAdminRole(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal memberikan role kepada admin",
+		})
+		return
+	}
+	var input AssignRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var adminRole models.AdminRole
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		adminRole, err = models.AssignRole(tx, adminId, input.Role, adminContext)
+		return err
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal memberikan role kepada admin yang dimaksud.")
+		return
+	}
+
+	models.NotifyGroupTemplate("admin_role_changed.txt", gin.H{"AdminID": adminId, "Role": input.Role, "Assigned": true, "By": adminContext.User.Name})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      adminRole,
+		"description": "Berhasil memberikan role kepada admin yang dimaksud.",
+	})
+}
+
+func RemoveAdminRole(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mencabut role dari admin",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		return models.RemoveRole(tx, adminId, c.Param("role"))
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal mencabut role dari admin yang dimaksud.")
+		return
+	}
+
+	models.NotifyGroupTemplate("admin_role_changed.txt", gin.H{"AdminID": adminId, "Role": c.Param("role"), "Assigned": false, "By": adminContext.User.Name})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      nil,
+		"description": "Berhasil mencabut role dari admin yang dimaksud.",
+	})
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	redis "github.com/go-redis/redis/v7"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+type SessionResult struct {
+	utils.Session
+	Current bool `json:"current"`
+}
+
+// currentSessionId is the session of the token the request came with. It is
+// empty for a token from before sessions were recorded.
+func currentSessionId(c *gin.Context) string {
+	au, err := utils.ExtractTokenMetadata(c.Request)
+	if err != nil {
+		return ""
+	}
+	return au.SessionId
+}
+
+func GetMySessions(c *gin.Context) {
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	sessions, err := utils.GetUserSessions(adminContext.UserID)
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengambil daftar sesi dari database.",
+		})
+		return
+	}
+
+	currentSession := currentSessionId(c)
+	var sessionResults = []SessionResult{}
+	for _, session := range sessions {
+		sessionResults = append(sessionResults, SessionResult{Session: session, Current: session.ID == currentSession})
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"data": sessionResults},
+		"description": "Berhasil mengambil daftar sesi yang aktif.",
+	})
+}
+
+func RevokeMySession(c *gin.Context) {
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	err := utils.DeleteSession(adminContext.UserID, c.Param("id"))
+	if err == redis.Nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      "Sesi tidak ditemukan.",
+			"result":      nil,
+			"description": "Gagal menemukan sesi dengan ID yang dimaksud.",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengakhiri sesi yang dimaksud.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      nil,
+		"description": "Berhasil mengakhiri sesi yang dimaksud.",
+	})
+}
+
+// RevokeMySessions ends every session of the admin. With except_current=true
+// the session the request came from is kept.
+func RevokeMySessions(c *gin.Context) {
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var keepSession = ""
+	if c.Query("except_current") == "true" {
+		keepSession = currentSessionId(c)
+	}
+	revoked, err := utils.DeleteUserSessions(adminContext.UserID, keepSession)
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengakhiri sesi-sesi dari admin ini.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"revoked": revoked},
+		"description": "Berhasil mengakhiri sesi-sesi dari admin ini.",
+	})
+}
+
+// ForceLogoutAdmin ends every session of another admin.
+func ForceLogoutAdmin(c *gin.Context) {
+	adminId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengakhiri sesi admin",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var admin models.Admin
+	if err := services.DB.Preload("User").First(&admin, adminId).Error; err != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan admin dengan ID yang dimaksud.",
+		})
+		return
+	}
+
+	revoked, err := utils.DeleteUserSessions(admin.UserID, "")
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengakhiri sesi-sesi dari admin yang dimaksud.",
+		})
+		return
+	}
+
+	models.NotifyGroupTemplate("admin_logged_out.txt", gin.H{"Admin": admin.Name, "By": adminContext.User.Name, "Revoked": revoked})
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"revoked": revoked},
+		"description": "Berhasil mengakhiri sesi-sesi dari admin yang dimaksud.",
+	})
+}
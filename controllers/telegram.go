@@ -0,0 +1,333 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+// a vendor who pressed Reject has this long to send the reason
+const telegramRejectReasonTTL = time.Hour
+
+func telegramRejectReasonKey(chatId int64) string {
+	return "telegram-reject-reason:" + strconv.FormatInt(chatId, 10)
+}
+
+// vendorOrderButtons are attached to the order notification sent to a vendor.
+// Their callback data is "<action>:<order ID>:<vendor ID>".
+func vendorOrderButtons(orderId uint64, vendorId uint64) [][]services.TelegramButton {
+	data := func(action string) string {
+		return action + ":" + strconv.FormatUint(orderId, 10) + ":" + strconv.FormatUint(vendorId, 10)
+	}
+	return [][]services.TelegramButton{
+		{
+			{Text: "Terima", CallbackData: data(models.VendorActionAccept)},
+			{Text: "Tolak", CallbackData: data(models.VendorActionReject)},
+		},
+		{
+			{Text: "Siap Diantar", CallbackData: data(models.VendorActionReady)},
+			{Text: "Sudah Diantar", CallbackData: data(models.VendorActionDelivered)},
+		},
+	}
+}
+
+func parseVendorOrderCallback(data string) (string, uint64, uint64, error) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		return "", 0, 0, errors.New("format callback tidak dikenal")
+	}
+	orderId, errOrderId := strconv.ParseUint(parts[1], 10, 64)
+	vendorId, errVendorId := strconv.ParseUint(parts[2], 10, 64)
+	if errOrderId != nil || errVendorId != nil {
+		return "", 0, 0, errors.New("ID order atau vendor pada callback tidak valid")
+	}
+	return parts[0], orderId, vendorId, nil
+}
+
+// vendorOrderStore is where the webhook reads the vendors and their order
+// details, and records what the vendors answered. Tests replace it with a fake
+// one.
+type vendorOrderStore interface {
+	findVendor(vendorId uint64) (models.Vendor, error)
+	orderDetailIds(orderId uint64, vendorId uint64, statuses []models.OrderDetailStatus) ([]uint64, error)
+	applyVendorAction(orderDetailIds []uint64, next models.OrderDetailStatus, update map[string]interface{}, vendor models.Vendor, response models.VendorResponse) error
+	notifyGroup(template string, data gin.H)
+}
+
+type dbVendorOrderStore struct{}
+
+var telegramStore vendorOrderStore = dbVendorOrderStore{}
+
+func (dbVendorOrderStore) findVendor(vendorId uint64) (models.Vendor, error) {
+	var vendor models.Vendor
+	err := services.DB.Preload("User").First(&vendor, vendorId).Error
+	return vendor, err
+}
+
+func (dbVendorOrderStore) orderDetailIds(orderId uint64, vendorId uint64, statuses []models.OrderDetailStatus) ([]uint64, error) {
+	var orderDetailIds []uint64
+	err := services.DB.Model(&models.OrderDetail{}).
+		Where("order_id = ?", orderId).
+		Where("menu_id IN (?)", services.DB.Model(&models.Menu{}).Select("id").Where("vendor_id = ?", vendorId)).
+		Where("status IN ?", statuses).
+		Pluck("id", &orderDetailIds).Error
+	return orderDetailIds, err
+}
+
+// applyVendorAction moves the details to next and records the response of
+// the vendor, in one transaction.
+func (dbVendorOrderStore) applyVendorAction(orderDetailIds []uint64, next models.OrderDetailStatus, update map[string]interface{}, vendor models.Vendor, response models.VendorResponse) error {
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		update["updated_at"] = time.Now()
+		update["created_by"] = vendor.User.Name
+		if err := models.TransitionOrderDetail(tx, map[string]interface{}{"id": orderDetailIds}, next, update); err != nil {
+			return err
+		}
+		if _, err := models.RecountOrder(tx, response.OrderID, vendor.User.Name); err != nil {
+			return err
+		}
+		return tx.Create(&response).Error
+	})
+}
+
+func (dbVendorOrderStore) notifyGroup(template string, data gin.H) {
+	models.NotifyGroupTemplate(template, data)
+}
+
+// findTelegramVendor loads the vendor and makes sure the update came from its
+// telegram chat.
+func findTelegramVendor(vendorId uint64, chatId int64, fromId int64) (models.Vendor, error) {
+	vendor, err := telegramStore.findVendor(vendorId)
+	if err != nil {
+		return vendor, err
+	}
+	if vendor.VendorTelegramID == "" ||
+		(vendor.VendorTelegramID != strconv.FormatInt(chatId, 10) && vendor.VendorTelegramID != strconv.FormatInt(fromId, 10)) {
+		return vendor, errors.New("akun telegram ini tidak terdaftar sebagai vendor dari order tersebut")
+	}
+	return vendor, nil
+}
+
+// vendorActionFrom lists the statuses a detail may have for each action of a
+// vendor, so pressing a button twice does not move a detail backwards.
+var vendorActionFrom = map[string][]models.OrderDetailStatus{
+	models.VendorActionAccept:    {models.OrderDetailSent},
+	models.VendorActionReady:     {models.OrderDetailSent, models.OrderDetailAccepted},
+	models.VendorActionDelivered: {models.OrderDetailSent, models.OrderDetailAccepted, models.OrderDetailReady},
+	models.VendorActionReject:    {models.OrderDetailSent, models.OrderDetailAccepted, models.OrderDetailReady},
+}
+
+// vendorOrderDetailIds lists the details of an order from a vendor which the
+// vendor can still apply action to.
+func vendorOrderDetailIds(orderId uint64, vendorId uint64, action string) ([]uint64, error) {
+	return telegramStore.orderDetailIds(orderId, vendorId, vendorActionFrom[action])
+}
+
+func respondTelegramWebhook(c *gin.Context, err error, description string) {
+	// telegram keeps retrying an update which is not answered with 200,
+	// so a rejected update is still acknowledged
+	if err != nil {
+		c.JSON(200, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": description,
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      nil,
+		"description": description,
+	})
+}
+
+func TelegramWebhook(c *gin.Context) {
+	// without a secret anyone could post updates in the name of a vendor, so
+	// the webhook stays closed until one is set
+	secret := os.Getenv("TELEGRAM_WEBHOOK_SECRET")
+	if secret == "" {
+		c.JSON(403, gin.H{
+			"status":      "failed",
+			"errors":      "TELEGRAM_WEBHOOK_SECRET belum diatur.",
+			"result":      nil,
+			"description": "Webhook Telegram tidak aktif.",
+		})
+		return
+	}
+	token := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		c.JSON(403, gin.H{
+			"status":      "failed",
+			"errors":      "Secret token tidak valid.",
+			"result":      nil,
+			"description": "Permintaan tidak berasal dari Telegram.",
+		})
+		return
+	}
+
+	var update services.TelegramUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+
+	if update.CallbackQuery != nil {
+		handleVendorOrderCallback(c, *update.CallbackQuery)
+		return
+	}
+	if update.Message != nil && update.Message.Text != "" {
+		handleVendorRejectReason(c, *update.Message)
+		return
+	}
+	respondTelegramWebhook(c, nil, "Tidak ada yang perlu diproses dari update ini.")
+}
+
+func handleVendorOrderCallback(c *gin.Context, callback services.TelegramCallbackQuery) {
+	action, orderId, vendorId, err := parseVendorOrderCallback(callback.Data)
+	if err != nil {
+		services.AnswerTelegramCallback(callback.ID, "Tombol tidak dikenal.")
+		respondTelegramWebhook(c, err, "Gagal memproses tombol yang ditekan.")
+		return
+	}
+	var chatId = callback.From.ID
+	if callback.Message != nil {
+		chatId = callback.Message.Chat.ID
+	}
+	vendor, err := findTelegramVendor(vendorId, chatId, callback.From.ID)
+	if err != nil {
+		services.AnswerTelegramCallback(callback.ID, "Anda tidak berhak memproses order ini.")
+		respondTelegramWebhook(c, err, "Gagal memverifikasi vendor.")
+		return
+	}
+
+	orderDetailIds, err := vendorOrderDetailIds(orderId, vendorId, action)
+	if err != nil {
+		services.AnswerTelegramCallback(callback.ID, "Terjadi kesalahan, silakan coba lagi.")
+		respondTelegramWebhook(c, err, "Gagal mengeksekusi query order details.")
+		return
+	}
+	if len(orderDetailIds) == 0 {
+		services.AnswerTelegramCallback(callback.ID, "Order ini sudah tidak dapat diproses.")
+		respondTelegramWebhook(c, errors.New("tidak ada menu dari vendor ini pada order tersebut yang dapat diproses"), "Order sudah tidak dapat diproses oleh vendor.")
+		return
+	}
+
+	orderID := strconv.FormatUint(orderId, 10)
+	response := models.VendorResponse{
+		OrderID:   orderId,
+		VendorID:  vendorId,
+		Action:    action,
+		ChatID:    strconv.FormatInt(chatId, 10),
+		CreatedAt: time.Now(),
+	}
+	var answer string
+	var template string
+	switch action {
+	case models.VendorActionAccept:
+		err = telegramStore.applyVendorAction(orderDetailIds, models.OrderDetailAccepted, map[string]interface{}{}, vendor, response)
+		answer = "Order #" + orderID + " diterima."
+		template = "vendor_accepted.txt"
+	case models.VendorActionReady:
+		err = telegramStore.applyVendorAction(orderDetailIds, models.OrderDetailReady, map[string]interface{}{}, vendor, response)
+		answer = "Order #" + orderID + " ditandai siap diantar."
+		template = "vendor_ready.txt"
+	case models.VendorActionDelivered:
+		err = telegramStore.applyVendorAction(orderDetailIds, models.OrderDetailDelivered, map[string]interface{}{}, vendor, response)
+		answer = "Order #" + orderID + " ditandai sudah diantar."
+		template = "vendor_delivered.txt"
+	case models.VendorActionReject:
+		// the reason comes in the next message from the chat
+		pending := orderID + ":" + strconv.FormatUint(vendorId, 10)
+		err = services.GetRedis().Set(telegramRejectReasonKey(chatId), pending, telegramRejectReasonTTL).Err()
+		if err == nil {
+			err = services.SendTelegramForceReply("Tuliskan alasan penolakan order #"+orderID+":", strconv.FormatInt(chatId, 10))
+		}
+		answer = "Silakan kirimkan alasan penolakan."
+	default:
+		err = errors.New("aksi " + action + " tidak dikenal")
+	}
+	if err != nil {
+		services.AnswerTelegramCallback(callback.ID, "Gagal memproses order, silakan coba lagi.")
+		respondTelegramWebhook(c, err, "Gagal memproses tanggapan vendor.")
+		return
+	}
+
+	services.AnswerTelegramCallback(callback.ID, answer)
+	if template != "" {
+		telegramStore.notifyGroup(template, gin.H{"Vendor": vendor.User.Name, "OrderID": orderId})
+	}
+	respondTelegramWebhook(c, nil, "Berhasil memproses tanggapan vendor.")
+}
+
+func handleVendorRejectReason(c *gin.Context, message services.TelegramMessage) {
+	key := telegramRejectReasonKey(message.Chat.ID)
+	pending, err := services.GetRedis().Get(key).Result()
+	if err != nil {
+		// not an answer to a rejection, nothing to do
+		respondTelegramWebhook(c, nil, "Tidak ada yang perlu diproses dari pesan ini.")
+		return
+	}
+	_, orderId, vendorId, err := parseVendorOrderCallback(models.VendorActionReject + ":" + pending)
+	if err != nil {
+		respondTelegramWebhook(c, err, "Gagal memproses alasan penolakan.")
+		return
+	}
+	var fromId int64
+	if message.From != nil {
+		fromId = message.From.ID
+	}
+	vendor, err := findTelegramVendor(vendorId, message.Chat.ID, fromId)
+	if err != nil {
+		respondTelegramWebhook(c, err, "Gagal memverifikasi vendor.")
+		return
+	}
+
+	chatId := strconv.FormatInt(message.Chat.ID, 10)
+	orderID := strconv.FormatUint(orderId, 10)
+	orderDetailIds, err := vendorOrderDetailIds(orderId, vendorId, models.VendorActionReject)
+	if err != nil {
+		respondTelegramWebhook(c, err, "Gagal mengeksekusi query order details.")
+		return
+	}
+	services.GetRedis().Del(key)
+	if len(orderDetailIds) == 0 {
+		services.SendTelegramToVendor("Order #"+orderID+" sudah tidak dapat ditolak.", chatId)
+		respondTelegramWebhook(c, errors.New("tidak ada menu dari vendor ini pada order tersebut yang dapat ditolak"), "Order sudah tidak dapat ditolak oleh vendor.")
+		return
+	}
+
+	reason := strings.TrimSpace(message.Text)
+	errRejecting := telegramStore.applyVendorAction(orderDetailIds, models.OrderDetailCancelled, map[string]interface{}{"reason_for_cancellation": reason}, vendor, models.VendorResponse{
+		OrderID:   orderId,
+		VendorID:  vendorId,
+		Action:    models.VendorActionReject,
+		Reason:    reason,
+		ChatID:    chatId,
+		CreatedAt: time.Now(),
+	})
+	if errRejecting != nil {
+		services.SendTelegramToVendor("Gagal menolak order #"+orderID+", silakan coba lagi.", chatId)
+		respondTelegramWebhook(c, errRejecting, "Gagal membatalkan detail order yang ditolak vendor.")
+		return
+	}
+
+	services.SendTelegramToVendor("Order #"+orderID+" sudah ditolak.", chatId)
+	telegramStore.notifyGroup("vendor_rejected.txt", gin.H{"Vendor": vendor.User.Name, "OrderID": orderId, "Reason": reason})
+	respondTelegramWebhook(c, nil, "Berhasil membatalkan detail order yang ditolak vendor.")
+}
@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+// fakeVendorOrderStore keeps the details of one order in memory and moves
+// them with the same transition table as the database.
+type fakeVendorOrderStore struct {
+	vendors         map[uint64]models.Vendor
+	details         map[uint64]*models.OrderDetail
+	detailVendorIds map[uint64]uint64
+	responses       []models.VendorResponse
+	notified        []string
+}
+
+func (store *fakeVendorOrderStore) findVendor(vendorId uint64) (models.Vendor, error) {
+	vendor, ok := store.vendors[vendorId]
+	if !ok {
+		return vendor, gorm.ErrRecordNotFound
+	}
+	return vendor, nil
+}
+
+func (store *fakeVendorOrderStore) orderDetailIds(orderId uint64, vendorId uint64, statuses []models.OrderDetailStatus) ([]uint64, error) {
+	var orderDetailIds []uint64
+	for id, detail := range store.details {
+		if detail.OrderID != orderId || store.detailVendorIds[id] != vendorId {
+			continue
+		}
+		for _, status := range statuses {
+			if detail.Status == status {
+				orderDetailIds = append(orderDetailIds, id)
+			}
+		}
+	}
+	return orderDetailIds, nil
+}
+
+func (store *fakeVendorOrderStore) applyVendorAction(orderDetailIds []uint64, next models.OrderDetailStatus, update map[string]interface{}, vendor models.Vendor, response models.VendorResponse) error {
+	for _, id := range orderDetailIds {
+		if from := store.details[id].Status; !from.CanTransitionTo(next) {
+			return models.TransitionError{Entity: "detail order", From: string(from), To: string(next)}
+		}
+	}
+	for _, id := range orderDetailIds {
+		store.details[id].Status = next
+		if reason, ok := update["reason_for_cancellation"].(string); ok {
+			store.details[id].ReasonForCancellation = reason
+		}
+	}
+	store.responses = append(store.responses, response)
+	return nil
+}
+
+func (store *fakeVendorOrderStore) notifyGroup(template string, data gin.H) {
+	store.notified = append(store.notified, template)
+}
+
+// useFakeVendorOrderStore puts vendor 7, whose telegram chat is 100, and its
+// detail 11 of order 1 in status in place of the database.
+func useFakeVendorOrderStore(t *testing.T, status models.OrderDetailStatus) *fakeVendorOrderStore {
+	store := &fakeVendorOrderStore{
+		vendors: map[uint64]models.Vendor{
+			7: {ID: 7, VendorTelegramID: "100", User: models.User{Name: "Warung Bu Sri"}},
+		},
+		details: map[uint64]*models.OrderDetail{
+			11: {ID: 11, OrderID: 1, Status: status},
+		},
+		detailVendorIds: map[uint64]uint64{11: 7},
+	}
+	original := telegramStore
+	telegramStore = store
+	t.Cleanup(func() { telegramStore = original })
+	return store
+}
+
+// fakeTelegram stands in for the bot API and keeps the last payload of every
+// method.
+func fakeTelegram(t *testing.T) map[string]map[string]interface{} {
+	var mutex sync.Mutex
+	requests := map[string]map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]interface{}
+		json.Unmarshal(body, &payload)
+		mutex.Lock()
+		requests[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]] = payload
+		mutex.Unlock()
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("TELEGRAM_API_URL", server.URL)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:abc")
+	return requests
+}
+
+// fakeRedis serves the few redis commands the webhook uses from memory and
+// points services.GetRedis at it.
+type fakeRedis struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func (redis *fakeRedis) get(key string) (string, bool) {
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	value, ok := redis.values[key]
+	return value, ok
+}
+
+func (redis *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		count, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+		args := make([]string, count)
+		for i := range args {
+			sizeLine, _ := reader.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(sizeLine[1:]))
+			arg := make([]byte, size+2)
+			io.ReadFull(reader, arg)
+			args[i] = string(arg[:size])
+		}
+
+		redis.mutex.Lock()
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "SET":
+			redis.values[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case "GET":
+			if value, ok := redis.values[args[1]]; ok {
+				reply = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "DEL":
+			deleted := 0
+			for _, key := range args[1:] {
+				if _, ok := redis.values[key]; ok {
+					delete(redis.values, key)
+					deleted++
+				}
+			}
+			reply = ":" + strconv.Itoa(deleted) + "\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		redis.mutex.Unlock()
+		conn.Write([]byte(reply))
+	}
+}
+
+func useFakeRedis(t *testing.T) *fakeRedis {
+	redis := &fakeRedis{values: map[string]string{}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go redis.serve(conn)
+		}
+	}()
+	t.Setenv("REDIS_HOST", listener.Addr().String())
+	services.InitRedis()
+	return redis
+}
+
+func postTelegramUpdate(t *testing.T, secret string, update services.TelegramUpdate) (*httptest.ResponseRecorder, gin.H) {
+	gin.SetMode(gin.TestMode)
+	body, err := json.Marshal(update)
+	assert.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("POST", "/telegram/webhook", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		c.Request.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	}
+	TelegramWebhook(c)
+
+	var response gin.H
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response
+}
+
+func pressButton(data string, chatId int64) services.TelegramUpdate {
+	return services.TelegramUpdate{CallbackQuery: &services.TelegramCallbackQuery{
+		ID:      "cb-1",
+		From:    services.TelegramUser{ID: chatId},
+		Message: &services.TelegramMessage{Chat: services.TelegramChat{ID: chatId}},
+		Data:    data,
+	}}
+}
+
+func TestTelegramWebhookNeedsTheSecret(t *testing.T) {
+	store := useFakeVendorOrderStore(t, models.OrderDetailSent)
+	update := pressButton("accept:1:7", 100)
+
+	t.Setenv("TELEGRAM_WEBHOOK_SECRET", "")
+	recorder, _ := postTelegramUpdate(t, "anything", update)
+	assert.Equal(t, 403, recorder.Code)
+
+	t.Setenv("TELEGRAM_WEBHOOK_SECRET", "s3cret")
+	recorder, _ = postTelegramUpdate(t, "", update)
+	assert.Equal(t, 403, recorder.Code)
+	recorder, _ = postTelegramUpdate(t, "s3cre", update)
+	assert.Equal(t, 403, recorder.Code)
+
+	assert.Equal(t, models.OrderDetailSent, store.details[11].Status)
+	assert.Empty(t, store.responses)
+}
+
+func TestTelegramWebhookRefusesAnotherChat(t *testing.T) {
+	t.Setenv("TELEGRAM_WEBHOOK_SECRET", "s3cret")
+	requests := fakeTelegram(t)
+	store := useFakeVendorOrderStore(t, models.OrderDetailSent)
+
+	recorder, response := postTelegramUpdate(t, "s3cret", pressButton("accept:1:7", 200))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "failed", response["status"])
+	assert.Equal(t, "Anda tidak berhak memproses order ini.", requests["answerCallbackQuery"]["text"])
+	assert.Equal(t, models.OrderDetailSent, store.details[11].Status)
+	assert.Empty(t, store.responses)
+}
+
+func TestTelegramWebhookMovesDetailsThroughTheTransitions(t *testing.T) {
+	t.Setenv("TELEGRAM_WEBHOOK_SECRET", "s3cret")
+	fakeTelegram(t)
+	store := useFakeVendorOrderStore(t, models.OrderDetailSent)
+
+	for _, step := range []struct {
+		action string
+		status models.OrderDetailStatus
+	}{
+		{models.VendorActionAccept, models.OrderDetailAccepted},
+		{models.VendorActionReady, models.OrderDetailReady},
+		{models.VendorActionDelivered, models.OrderDetailDelivered},
+	} {
+		_, response := postTelegramUpdate(t, "s3cret", pressButton(step.action+":1:7", 100))
+		assert.Equal(t, "success", response["status"], step.action)
+		assert.Equal(t, step.status, store.details[11].Status, step.action)
+	}
+	assert.Equal(t, []string{"vendor_accepted.txt", "vendor_ready.txt", "vendor_delivered.txt"}, store.notified)
+	assert.Len(t, store.responses, 3)
+
+	// a delivered detail cannot be accepted again
+	_, response := postTelegramUpdate(t, "s3cret", pressButton("accept:1:7", 100))
+	assert.Equal(t, "failed", response["status"])
+	assert.Equal(t, models.OrderDetailDelivered, store.details[11].Status)
+}
+
+func TestTelegramWebhookRejectReasonRoundTrip(t *testing.T) {
+	t.Setenv("TELEGRAM_WEBHOOK_SECRET", "s3cret")
+	requests := fakeTelegram(t)
+	redis := useFakeRedis(t)
+	store := useFakeVendorOrderStore(t, models.OrderDetailAccepted)
+
+	_, response := postTelegramUpdate(t, "s3cret", pressButton("reject:1:7", 100))
+	assert.Equal(t, "success", response["status"])
+	pending, ok := redis.get(telegramRejectReasonKey(100))
+	assert.True(t, ok)
+	assert.Equal(t, "1:7", pending)
+	assert.Equal(t, "Tuliskan alasan penolakan order #1:", requests["sendMessage"]["text"])
+	assert.Equal(t, models.OrderDetailAccepted, store.details[11].Status)
+
+	_, response = postTelegramUpdate(t, "s3cret", services.TelegramUpdate{Message: &services.TelegramMessage{
+		From: &services.TelegramUser{ID: 100},
+		Chat: services.TelegramChat{ID: 100},
+		Text: " Bahan habis ",
+	}})
+	assert.Equal(t, "success", response["status"])
+	assert.Equal(t, models.OrderDetailCancelled, store.details[11].Status)
+	assert.Equal(t, "Bahan habis", store.details[11].ReasonForCancellation)
+	if assert.Len(t, store.responses, 1) {
+		assert.Equal(t, models.VendorActionReject, store.responses[0].Action)
+		assert.Equal(t, "Bahan habis", store.responses[0].Reason)
+	}
+	_, ok = redis.get(telegramRejectReasonKey(100))
+	assert.False(t, ok)
+	assert.Equal(t, []string{"vendor_rejected.txt"}, store.notified)
+}
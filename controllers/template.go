@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+type TemplateUri struct {
+	Name string `uri:"name" binding:"required"`
+}
+
+type SaveTemplateInput struct {
+	Body string `json:"body" binding:"required"`
+}
+
+func GetTemplates(c *gin.Context) {
+	var templates []models.TemplateInfo
+	for _, name := range models.TemplateNames() {
+		info, err := models.GetTemplate(name)
+		if err != nil {
+			c.JSON(512, gin.H{
+				"status":      "failed",
+				"errors":      err.Error(),
+				"result":      nil,
+				"description": "Gagal membaca template " + name + ".",
+			})
+			return
+		}
+		templates = append(templates, models.TemplateInfo{Name: info.Name, Source: info.Source})
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"data": templates},
+		"description": "Berhasil mengambil daftar template pesan.",
+	})
+}
+
+func GetTemplate(c *gin.Context) {
+	var uri TemplateUri
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak bisa mengolah data dari URI yang ada: " + err.Error(),
+			"result":      nil,
+			"description": "URI yang ada tidak sesuai dengan ketentuan.",
+		})
+		return
+	}
+
+	info, err := models.GetTemplate(uri.Name)
+	if err != nil {
+		respondTemplateError(c, err, "Gagal mengambil template pesan.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      info,
+		"description": "Berhasil mengambil template pesan.",
+	})
+}
+
+func SaveTemplate(c *gin.Context) {
+	var uri TemplateUri
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak bisa mengolah data dari URI yang ada: " + err.Error(),
+			"result":      nil,
+			"description": "URI yang ada tidak sesuai dengan ketentuan.",
+		})
+		return
+	}
+	var input SaveTemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	messageTemplate, err := models.SaveTemplate(services.DB, uri.Name, input.Body, adminContext.User.Name)
+	if err != nil {
+		respondTemplateError(c, err, "Gagal menyimpan template pesan.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      messageTemplate,
+		"description": "Berhasil menyimpan template pesan.",
+	})
+}
+
+func ResetTemplate(c *gin.Context) {
+	var uri TemplateUri
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak bisa mengolah data dari URI yang ada: " + err.Error(),
+			"result":      nil,
+			"description": "URI yang ada tidak sesuai dengan ketentuan.",
+		})
+		return
+	}
+
+	if err := models.ResetTemplate(services.DB, uri.Name); err != nil {
+		respondTemplateError(c, err, "Gagal mengembalikan template pesan ke bawaan.")
+		return
+	}
+
+	info, _ := models.GetTemplate(uri.Name)
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      info,
+		"description": "Berhasil mengembalikan template pesan ke bawaan.",
+	})
+}
+
+// respondTemplateError answers 404 for an unknown template, 512 when the
+// database fails, and 422 for a body which does not parse.
+func respondTemplateError(c *gin.Context, err error, description string) {
+	var code = 422
+	if errors.Is(err, models.ErrTemplateNotFound) {
+		code = 404
+	} else if _, isTemplateError := err.(models.TemplateParseError); !isTemplateError {
+		code = 512
+	}
+	c.JSON(code, gin.H{
+		"status":      "failed",
+		"errors":      err.Error(),
+		"result":      nil,
+		"description": description,
+	})
+}
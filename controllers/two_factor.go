@@ -0,0 +1,400 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	redis "github.com/go-redis/redis/v7"
+	"github.com/twinj/uuid"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+const (
+	// how long an admin has to send the 2FA code after the password
+	pendingLoginDuration = 5 * time.Minute
+	// how many wrong codes a pending login takes before it is dropped
+	pendingLoginAttempts = 5
+)
+
+func pendingLoginKey(token string) string {
+	return "pending-login:" + token
+}
+
+func pendingLoginAttemptsKey(token string) string {
+	return "pending-login-attempts:" + token
+}
+
+// issueLoginTokens starts a session for an admin who passed every step of the
+// login, which also forgives the failed logins of its email.
+func issueLoginTokens(c *gin.Context, admin models.Admin) {
+	if err := utils.ClearLoginFailures(admin.User.Email); err != nil {
+		log.Print("Failed to clear the login failures of ", admin.User.Email, ": ", err.Error())
+	}
+	ts, err := utils.CreateToken(admin.UserID, "")
+	if err != nil {
+		c.JSON(500, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Tidak dapat membuat token untuk proses autentikasi.",
+		})
+		return
+	}
+	saveErr := utils.CreateAuth(admin.UserID, ts, utils.NewClientInfo(c.Request, c.ClientIP()))
+	if saveErr != nil {
+		c.JSON(500, gin.H{
+			"status":      "failed",
+			"errors":      saveErr.Error(),
+			"result":      nil,
+			"description": "Gagal membuat autentikasi user.",
+		})
+		return
+	}
+	data := map[string]interface{}{
+		"token": ts,
+		"admin": models.NewAdminView(admin),
+	}
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      data,
+		"description": "Berhasil login",
+	})
+}
+
+// startTwoFactorLogin answers a correct password of an admin who uses 2FA
+// with a pending login token instead of the session tokens.
+func startTwoFactorLogin(c *gin.Context, admin models.Admin) {
+	pendingToken := uuid.NewV4().String()
+	err := services.GetRedis().Set(pendingLoginKey(pendingToken), strconv.FormatUint(admin.ID, 10), pendingLoginDuration).Err()
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menyimpan data login pada database.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"errors": nil,
+		"result": map[string]interface{}{
+			"two_factor_required": true,
+			"pending_token":       pendingToken,
+			"expires_in":          int(pendingLoginDuration.Seconds()),
+		},
+		"description": "Password benar, kirimkan kode 2FA untuk menyelesaikan login.",
+	})
+}
+
+type TwoFactorLoginInput struct {
+	PendingToken string `json:"pending_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func AdminLoginTwoFactor(c *gin.Context) {
+	var input TwoFactorLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+
+	pendingAdminId, err := services.GetRedis().Get(pendingLoginKey(input.PendingToken)).Result()
+	if err == redis.Nil {
+		c.JSON(403, gin.H{
+			"status":      "failed",
+			"errors":      "Token login tidak valid atau sudah kadaluwarsa.",
+			"result":      nil,
+			"description": "Silakan login kembali dengan email dan password.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal membaca data login dari database.",
+		})
+		return
+	}
+	adminId, _ := strconv.ParseUint(pendingAdminId, 10, 64)
+
+	var admin models.Admin
+	if err := services.DB.Preload("User").First(&admin, adminId).Error; err != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan data admin.",
+		})
+		return
+	}
+
+	// a locked email cannot get around the lock with 2FA codes either
+	retryAfter, err := utils.LoginRetryAfter(admin.User.Email, c.ClientIP())
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memeriksa batas percobaan login.",
+		})
+		return
+	}
+	if retryAfter > 0 {
+		respondLoginRetryAfter(c, retryAfter)
+		return
+	}
+
+	errChecking := services.DB.Transaction(func(tx *gorm.DB) error {
+		return models.CheckTwoFactor(tx, adminId, input.Code, input.RecoveryCode)
+	})
+	var accountError models.AdminAccountError
+	if errors.As(errChecking, &accountError) {
+		// a wrong code counts like a wrong password, so new pending logins do
+		// not give an attacker who knows the password more guesses
+		locked := countLoginFailure(c, admin.User.Email, admin.User)
+		attempts, _ := services.GetRedis().Incr(pendingLoginAttemptsKey(input.PendingToken)).Result()
+		services.GetRedis().Expire(pendingLoginAttemptsKey(input.PendingToken), pendingLoginDuration)
+		if locked || attempts >= pendingLoginAttempts {
+			services.GetRedis().Del(pendingLoginKey(input.PendingToken), pendingLoginAttemptsKey(input.PendingToken))
+		}
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      errChecking.Error(),
+			"result":      nil,
+			"description": "Gagal memverifikasi kode 2FA.",
+		})
+		return
+	}
+	if errChecking != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      errChecking.Error(),
+			"result":      nil,
+			"description": "Gagal memverifikasi kode 2FA.",
+		})
+		return
+	}
+
+	// the pending login can only be completed once
+	deleted, err := services.GetRedis().Del(pendingLoginKey(input.PendingToken)).Result()
+	if err != nil || deleted == 0 {
+		c.JSON(403, gin.H{
+			"status":      "failed",
+			"errors":      "Token login sudah dipakai.",
+			"result":      nil,
+			"description": "Silakan login kembali dengan email dan password.",
+		})
+		return
+	}
+	services.GetRedis().Del(pendingLoginAttemptsKey(input.PendingToken))
+
+	issueLoginTokens(c, admin)
+}
+
+func GetTwoFactor(c *gin.Context) {
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	twoFactor, err := models.GetAdminTwoFactor(adminContext.ID)
+	if err == nil {
+		var required bool
+		required, err = models.IsTwoFactorRequired()
+		if err == nil {
+			c.JSON(200, gin.H{
+				"status": "success",
+				"errors": nil,
+				"result": map[string]interface{}{
+					"enabled":                  twoFactor.Enabled,
+					"enabled_at":               twoFactor.EnabledAt,
+					"required":                 required,
+					"remaining_recovery_codes": twoFactor.RemainingRecoveryCodes(),
+				},
+				"description": "Berhasil mengambil status 2FA.",
+			})
+			return
+		}
+	}
+	c.JSON(512, gin.H{
+		"status":      "failed",
+		"errors":      err.Error(),
+		"result":      nil,
+		"description": "Gagal mengambil status 2FA.",
+	})
+}
+
+func EnrollTwoFactor(c *gin.Context) {
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var twoFactor models.AdminTwoFactor
+	var otpauthUri string
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		twoFactor, otpauthUri, err = models.EnrollTwoFactor(tx, adminContext)
+		return err
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal mendaftarkan 2FA.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status": "success",
+		"errors": nil,
+		"result": map[string]interface{}{
+			"secret":      twoFactor.Secret,
+			"otpauth_uri": otpauthUri,
+		},
+		"description": "Pindai QR code dari otpauth_uri dengan aplikasi authenticator, lalu kirimkan kodenya untuk mengaktifkan 2FA.",
+	})
+}
+
+type TwoFactorCodeInput struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func VerifyTwoFactor(c *gin.Context) {
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var recoveryCodes []string
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		recoveryCodes, err = models.VerifyTwoFactor(tx, adminContext.ID, input.Code)
+		return err
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal mengaktifkan 2FA.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"recovery_codes": recoveryCodes},
+		"description": "Berhasil mengaktifkan 2FA. Simpan kode pemulihan ini, kode tidak akan ditampilkan lagi.",
+	})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var recoveryCodes []string
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		recoveryCodes, err = models.RegenerateRecoveryCodes(tx, adminContext.ID, input.Code)
+		return err
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal membuat kode pemulihan yang baru.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      map[string]interface{}{"recovery_codes": recoveryCodes},
+		"description": "Berhasil membuat kode pemulihan yang baru. Kode yang lama sudah tidak berlaku.",
+	})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	err := services.DB.Transaction(func(tx *gorm.DB) error {
+		return models.DisableTwoFactor(tx, adminContext.ID, input.Code, input.RecoveryCode)
+	})
+	if err != nil {
+		respondAdminAccountError(c, err, "Gagal menonaktifkan 2FA.")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      nil,
+		"description": "Berhasil menonaktifkan 2FA.",
+	})
+}
+
+type RequireTwoFactorInput struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+// RequireTwoFactor turns on or off the requirement for every admin to use 2FA.
+func RequireTwoFactor(c *gin.Context) {
+	var input RequireTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	setting, err := models.SaveSetting(services.DB, models.SettingRequireTwoFactor, strconv.FormatBool(*input.Required), adminContext.User.Name)
+	if err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menyimpan pengaturan 2FA.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      setting,
+		"description": "Berhasil menyimpan pengaturan 2FA.",
+	})
+}
@@ -0,0 +1,518 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/services"
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+type VendorResult struct {
+	models.Vendor
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// View hides the sensitive data of the vendor unless revealSensitive is set.
+func (result VendorResult) View(revealSensitive bool) models.VendorView {
+	vendor := result.Vendor
+	vendor.User.Name = result.Name
+	vendor.User.Email = result.Email
+	return models.NewVendorView(vendor, revealSensitive)
+}
+
+// revealSensitiveData tells whether a request gets the sensitive data of
+// vendors in full: it has to ask with reveal_sensitive=true, from an admin who
+// is allowed to see it.
+func revealSensitiveData(c *gin.Context) bool {
+	if c.Query("reveal_sensitive") != "true" {
+		return false
+	}
+	return c.MustGet("permissions").(models.PermissionSet).Has(models.PermissionVendorsSensitive)
+}
+
+// vendorQuery selects the vendors together with the name and email of their
+// user, without the rest of the user row.
+func vendorQuery() *gorm.DB {
+	return services.DB.Table("vendors").
+		Joins("LEFT JOIN users ON users.id = vendors.user_id").
+		Select("vendors.*, users.name AS name, users.email AS email")
+}
+
+func GetVendors(c *gin.Context) {
+	var vendors []VendorResult
+	var messages = []string{}
+
+	params := c.Request.URL.Query()
+
+	lengthParam, doesLengthParamExist := params["length"]
+	pageParam, doesPageParamExist := params["page"]
+	searchParam, doesSearchParamExist := params["search"]
+	statusParam, doesStatusParamExist := params["status"]
+
+	vendorsQuery := vendorQuery()
+
+	if doesSearchParamExist {
+		search := "%" + searchParam[0] + "%"
+		vendorsQuery = vendorsQuery.Where("users.name LIKE ? OR vendors.company_name LIKE ?", search, search)
+	}
+
+	if doesStatusParamExist {
+		vendorsQuery = vendorsQuery.Where("vendors.status = ?", statusParam[0])
+	}
+
+	var totalRows int64
+	vendorsQuery.Count(&totalRows)
+
+	if doesLengthParamExist {
+		length, err := strconv.Atoi(lengthParam[0])
+		if err != nil {
+			messages = append(messages, "Parameter Length tidak dapat dikonversi ke integer")
+		} else {
+			vendorsQuery = vendorsQuery.Limit(length)
+		}
+	}
+
+	if doesPageParamExist {
+		if doesLengthParamExist {
+			page, _ := strconv.Atoi(pageParam[0])
+			length, _ := strconv.Atoi(lengthParam[0])
+			offset := (page - 1) * length
+			vendorsQuery = vendorsQuery.Offset(offset)
+		} else {
+			messages = append(messages, "Tidak ada parameter Length, maka parameter Page diabaikan.")
+		}
+	}
+
+	vendorsQuery.Order("vendors.id").Scan(&vendors)
+	rowsCount := vendorsQuery.RowsAffected
+
+	if vendorsQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      vendorsQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query.",
+		})
+		return
+	}
+
+	revealSensitive := revealSensitiveData(c)
+	var vendorViews = []models.VendorView{}
+	for _, vendor := range vendors {
+		vendorViews = append(vendorViews, vendor.View(revealSensitive))
+	}
+
+	vendorData := map[string]interface{}{
+		"data":       vendorViews,
+		"rows_count": rowsCount,
+		"total_rows": totalRows,
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"result":      vendorData,
+		"errors":      messages,
+		"description": "Berhasil mengambil data vendor.",
+	})
+}
+
+func GetVendor(c *gin.Context) {
+	vendorId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengambil data vendor",
+		})
+		return
+	}
+
+	var vendor VendorResult
+	vendorsQuery := vendorQuery().Where("vendors.id = ?", vendorId).Scan(&vendor)
+	if vendorsQuery.Error != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      vendorsQuery.Error.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query vendor.",
+		})
+		return
+	}
+	if vendorsQuery.RowsAffected == 0 {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      gorm.ErrRecordNotFound.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan vendor dengan ID yang dimaksud.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      vendor.View(revealSensitiveData(c)),
+		"description": "Berhasil mengambil data vendor.",
+	})
+}
+
+type CreateVendorInput struct {
+	Name                 string    `json:"name" binding:"required"`
+	Email                string    `json:"email" binding:"required,email"`
+	Password             string    `json:"password" binding:"required,min=8"`
+	Phone                string    `json:"phone" binding:"required"`
+	CompanyName          string    `json:"company_name"`
+	CompanyType          string    `json:"company_type"`
+	Address              string    `json:"address" binding:"required"`
+	Village              string    `json:"village"`
+	District             string    `json:"district"`
+	Regency              string    `json:"regency"`
+	Province             string    `json:"province"`
+	PostalCode           string    `json:"postal_code"`
+	NPWPNumber           string    `json:"npwp_number"`
+	NPWPName             string    `json:"npwp_name"`
+	NPWPAddress          string    `json:"npwp_address"`
+	OfficerName          string    `json:"officer_name"`
+	OfficerPhone         string    `json:"officer_phone"`
+	OfficerPosition      string    `json:"officer_position"`
+	OfficerAddress       string    `json:"officer_address"`
+	OfficerIDNumber      string    `json:"officer_id_number"`
+	PKPNumber            string    `json:"pkp_number"`
+	PKPExpiryDate        time.Time `json:"pkp_expiry_date"`
+	BankName             string    `json:"bank_name"`
+	BankBranch           string    `json:"bank_branch"`
+	BankAccountNumber    string    `json:"bank_account_number"`
+	BankAccountName      string    `json:"bank_account_name"`
+	VendorMinOrderAmount uint      `json:"vendor_min_order_amount"`
+	VendorMinOrderQty    uint      `json:"vendor_min_order_qty"`
+	VendorDeliveryCost   uint      `json:"vendor_delivery_cost"`
+	VendorServiceCharge  uint      `json:"vendor_service_charge"`
+	VendorMargin         *float64  `json:"vendor_margin" binding:"omitempty,min=0,max=100"`
+	VendorNoteForMenus   string    `json:"vendor_note_for_menus"`
+	VendorTelegramID     string    `json:"vendor_telegram_id"`
+	Status               string    `json:"status" binding:"omitempty,oneof=Active Inactive"`
+}
+
+func CreateVendor(c *gin.Context) {
+	var input CreateVendorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	var existingUsers int64
+	if err := services.DB.Model(&models.User{}).Where("email = ?", input.Email).Count(&existingUsers).Error; err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query user.",
+		})
+		return
+	}
+	if existingUsers > 0 {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Email " + input.Email + " sudah digunakan.",
+			"result":      nil,
+			"description": "Gagal menambah vendor baru.",
+		})
+		return
+	}
+
+	hashedPassword, errHashingPassword := utils.HashPassword(input.Password)
+	if errHashingPassword != nil {
+		c.JSON(500, gin.H{
+			"status":      "failed",
+			"errors":      errHashingPassword.Error(),
+			"result":      nil,
+			"description": "Gagal membuat hash password.",
+		})
+		return
+	}
+
+	now := time.Now()
+	user := models.User{
+		Name:      input.Name,
+		Email:     input.Email,
+		Password:  hashedPassword,
+		Phone:     input.Phone,
+		Type:      models.VendorType,
+		Status:    "Activated",
+		CreatedBy: adminContext.User.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	vendor := models.Vendor{
+		CompanyName:          input.CompanyName,
+		CompanyType:          input.CompanyType,
+		Phone:                input.Phone,
+		Address:              input.Address,
+		Village:              input.Village,
+		District:             input.District,
+		Regency:              input.Regency,
+		Province:             input.Province,
+		PostalCode:           input.PostalCode,
+		NPWPNumber:           input.NPWPNumber,
+		NPWPName:             input.NPWPName,
+		NPWPAddress:          input.NPWPAddress,
+		OfficerName:          input.OfficerName,
+		OfficerPhone:         input.OfficerPhone,
+		OfficerPosition:      input.OfficerPosition,
+		OfficerAddress:       input.OfficerAddress,
+		OfficerIDNumber:      input.OfficerIDNumber,
+		PKPNumber:            input.PKPNumber,
+		PKPExpiryDate:        input.PKPExpiryDate,
+		BankName:             input.BankName,
+		BankBranch:           input.BankBranch,
+		BankAccountNumber:    input.BankAccountNumber,
+		BankAccountName:      input.BankAccountName,
+		VendorMinOrderAmount: input.VendorMinOrderAmount,
+		VendorMinOrderQty:    input.VendorMinOrderQty,
+		VendorDeliveryCost:   input.VendorDeliveryCost,
+		VendorServiceCharge:  input.VendorServiceCharge,
+		VendorMargin:         10,
+		VendorNoteForMenus:   input.VendorNoteForMenus,
+		VendorTelegramID:     input.VendorTelegramID,
+		Status:               "Active",
+		CreatedBy:            adminContext.User.Name,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+	if input.VendorMinOrderQty == 0 {
+		vendor.VendorMinOrderQty = 1
+	}
+	if input.VendorMargin != nil {
+		vendor.VendorMargin = *input.VendorMargin
+	}
+	if input.Status != "" {
+		vendor.Status = input.Status
+	}
+
+	errCreatingVendor := services.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		vendor.UserID = user.ID
+		omitted := []string{clause.Associations}
+		// a vendor without PKP keeps its expiry date NULL
+		if vendor.PKPExpiryDate.IsZero() {
+			omitted = append(omitted, "PKPExpiryDate")
+		}
+		return tx.Omit(omitted...).Create(&vendor).Error
+	})
+	if errCreatingVendor != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      errCreatingVendor.Error(),
+			"result":      nil,
+			"description": "Gagal menyimpan data vendor baru dalam database.",
+		})
+		return
+	}
+
+	models.NotifyGroupTemplate("vendor_created.txt", gin.H{"Vendor": user.Name, "Admin": adminContext.User.Name})
+
+	c.JSON(201, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      VendorResult{Vendor: vendor, Name: user.Name, Email: user.Email}.View(revealSensitiveData(c)),
+		"description": "Berhasil menambah vendor baru.",
+	})
+}
+
+type UpdateVendorInput struct {
+	Name                 *string    `json:"name" binding:"omitempty,min=1"`
+	Phone                *string    `json:"phone" binding:"omitempty,min=1"`
+	CompanyName          *string    `json:"company_name"`
+	CompanyType          *string    `json:"company_type"`
+	Address              *string    `json:"address" binding:"omitempty,min=1"`
+	Village              *string    `json:"village"`
+	District             *string    `json:"district"`
+	Regency              *string    `json:"regency"`
+	Province             *string    `json:"province"`
+	PostalCode           *string    `json:"postal_code"`
+	NPWPNumber           *string    `json:"npwp_number"`
+	NPWPName             *string    `json:"npwp_name"`
+	NPWPAddress          *string    `json:"npwp_address"`
+	OfficerName          *string    `json:"officer_name"`
+	OfficerPhone         *string    `json:"officer_phone"`
+	OfficerPosition      *string    `json:"officer_position"`
+	OfficerAddress       *string    `json:"officer_address"`
+	OfficerIDNumber      *string    `json:"officer_id_number"`
+	PKPNumber            *string    `json:"pkp_number"`
+	PKPExpiryDate        *time.Time `json:"pkp_expiry_date"`
+	BankName             *string    `json:"bank_name"`
+	BankBranch           *string    `json:"bank_branch"`
+	BankAccountNumber    *string    `json:"bank_account_number"`
+	BankAccountName      *string    `json:"bank_account_name"`
+	VendorMinOrderAmount *uint      `json:"vendor_min_order_amount"`
+	VendorMinOrderQty    *uint      `json:"vendor_min_order_qty" binding:"omitempty,min=1"`
+	VendorDeliveryCost   *uint      `json:"vendor_delivery_cost"`
+	VendorServiceCharge  *uint      `json:"vendor_service_charge"`
+	VendorMargin         *float64   `json:"vendor_margin" binding:"omitempty,min=0,max=100"`
+	VendorNoteForMenus   *string    `json:"vendor_note_for_menus"`
+	VendorTelegramID     *string    `json:"vendor_telegram_id"`
+	Status               *string    `json:"status" binding:"omitempty,oneof=Active Inactive"`
+}
+
+// columns maps every field sent in the request to the vendors column it edits.
+// Name is kept on the user and is left out.
+func (input UpdateVendorInput) columns() map[string]interface{} {
+	columns := map[string]interface{}{}
+	setString := func(column string, value *string) {
+		if value != nil {
+			columns[column] = *value
+		}
+	}
+	setUint := func(column string, value *uint) {
+		if value != nil {
+			columns[column] = *value
+		}
+	}
+	setString("phone", input.Phone)
+	setString("company_name", input.CompanyName)
+	setString("company_type", input.CompanyType)
+	setString("address", input.Address)
+	setString("village", input.Village)
+	setString("district", input.District)
+	setString("regency", input.Regency)
+	setString("province", input.Province)
+	setString("postal_code", input.PostalCode)
+	setString("npwp_number", input.NPWPNumber)
+	setString("npwp_name", input.NPWPName)
+	setString("npwp_address", input.NPWPAddress)
+	setString("officer_name", input.OfficerName)
+	setString("officer_phone", input.OfficerPhone)
+	setString("officer_position", input.OfficerPosition)
+	setString("officer_address", input.OfficerAddress)
+	setString("officer_id_number", input.OfficerIDNumber)
+	setString("pkp_number", input.PKPNumber)
+	if input.PKPExpiryDate != nil {
+		columns["pkp_expiry_date"] = *input.PKPExpiryDate
+	}
+	setString("bank_name", input.BankName)
+	setString("bank_branch", input.BankBranch)
+	setString("bank_account_number", input.BankAccountNumber)
+	setString("bank_account_name", input.BankAccountName)
+	setUint("vendor_min_order_amount", input.VendorMinOrderAmount)
+	setUint("vendor_min_order_qty", input.VendorMinOrderQty)
+	setUint("vendor_delivery_cost", input.VendorDeliveryCost)
+	setUint("vendor_service_charge", input.VendorServiceCharge)
+	if input.VendorMargin != nil {
+		columns["vendor_margin"] = *input.VendorMargin
+	}
+	setString("vendor_note_for_menus", input.VendorNoteForMenus)
+	setString("vendor_telegram_id", input.VendorTelegramID)
+	setString("status", input.Status)
+	return columns
+}
+
+func UpdateVendor(c *gin.Context) {
+	var input UpdateVendorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+	vendorId, notValidId := strconv.ParseUint(c.Param("id"), 10, 64)
+	if notValidId != nil {
+		c.JSON(400, gin.H{
+			"status":      "failed",
+			"errors":      "ID tidak valid",
+			"result":      nil,
+			"description": "Gagal mengubah data vendor",
+		})
+		return
+	}
+	adminContext := c.MustGet("admin").(models.Admin)
+
+	update := input.columns()
+	if len(update) == 0 && input.Name == nil {
+		c.JSON(422, gin.H{
+			"status":      "failed",
+			"errors":      "Tidak ada data vendor yang diubah.",
+			"result":      nil,
+			"description": "Gagal memproses data yang masuk.",
+		})
+		return
+	}
+
+	var vendor models.Vendor
+	if err := services.DB.First(&vendor, vendorId).Error; err != nil {
+		c.JSON(404, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal menemukan vendor dengan ID yang dimaksud.",
+		})
+		return
+	}
+
+	now := time.Now()
+	errUpdatingVendor := services.DB.Transaction(func(tx *gorm.DB) error {
+		// the name and phone of a vendor are also kept on its user
+		userUpdate := map[string]interface{}{}
+		if input.Name != nil {
+			userUpdate["name"] = *input.Name
+		}
+		if input.Phone != nil {
+			userUpdate["phone"] = *input.Phone
+		}
+		if len(userUpdate) > 0 {
+			userUpdate["updated_at"] = now
+			if err := tx.Model(&models.User{}).Where("id = ?", vendor.UserID).Updates(userUpdate).Error; err != nil {
+				return err
+			}
+		}
+
+		update["updated_at"] = now
+		update["created_by"] = adminContext.User.Name
+		return models.UpdateVendor(tx, map[string]interface{}{"id": vendorId}, update)
+	})
+	if errUpdatingVendor != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      errUpdatingVendor.Error(),
+			"result":      nil,
+			"description": "Gagal mengubah data vendor dalam database.",
+		})
+		return
+	}
+
+	var updatedVendor VendorResult
+	if err := vendorQuery().Where("vendors.id = ?", vendorId).Scan(&updatedVendor).Error; err != nil {
+		c.JSON(512, gin.H{
+			"status":      "failed",
+			"errors":      err.Error(),
+			"result":      nil,
+			"description": "Gagal mengeksekusi query vendor.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status":      "success",
+		"errors":      nil,
+		"result":      updatedVendor.View(revealSensitiveData(c)),
+		"description": "Berhasil mengubah data vendor.",
+	})
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/adeindriawan/itsfood-administration/controllers"
 	"github.com/adeindriawan/itsfood-administration/middlewares"
+	"github.com/adeindriawan/itsfood-administration/models"
+	"github.com/adeindriawan/itsfood-administration/routes"
 	"github.com/adeindriawan/itsfood-administration/services"
 	"github.com/adeindriawan/itsfood-administration/utils"
 	"github.com/gin-gonic/gin"
@@ -13,55 +16,39 @@ import (
 
 func init() {
 	utils.LoadEnvVars()
+	if err := utils.LoadTokenKeys(); err != nil {
+		panic("failed to load token keys: " + err.Error())
+	}
 	services.InitRedis()
 	services.InitMySQL()
+	if err := models.Migrate(); err != nil {
+		panic("failed to migrate database: " + err.Error())
+	}
 }
 
-func main() {
-	r := gin.Default()
-	r.Use(middlewares.CORS())
-
-	r.GET("/", func(c *gin.Context) {
-		response := "This is Itsfood Administration Service API Homepage."
-		c.Data(200, "text/html; charset: utf-8", []byte(response))
-	})
-
-	authorized := r.Group("/")
-	authorized.Use(middlewares.Authorized())
-	{
-		authorized.GET("/dummy/authorized", controllers.DummyAuthorizedController)
-		authorizedAdmin := authorized.Group("/")
-		authorizedAdmin.Use(middlewares.AuthorizedAdmin())
-		{
-			authorizedAdmin.GET("/dummy/authorized/admin", controllers.DummyAuthorizedAdminController)
-			authorizedActiveAdmin := authorizedAdmin.Group("/")
-			authorizedActiveAdmin.Use(middlewares.AuthorizedActiveAdmin())
-			{
-				authorizedActiveAdmin.GET("/orders", controllers.GetOrders)
-
-				authorizedActiveAdmin.GET("/customers", controllers.GetCustomers)
-
-				authorizedActiveAdmin.GET("/units", controllers.GetUnits)
-
-				authorizedActiveAdmin.GET("/orders/:id", controllers.GetOrder)
-				authorizedActiveAdmin.POST("/orders/:orderId/vendor/:vendorId/notify", controllers.NotifyAVendorForAnOrder)
-				authorizedActiveAdmin.GET("/orders/:id/vendors", controllers.GetVendorsInAnOrder)
-
-				authorizedActiveAdmin.POST("/order-details/:orderDetailId/menu/:menuId/change", controllers.ChangeMenuInAnOrder)
-				authorizedActiveAdmin.POST("/order-details/:orderDetailId/qty", controllers.ChangeQtyOfAMenuInAnOrder)
-				authorizedActiveAdmin.POST("/order-details/:orderDetailId/note", controllers.ChangeNoteOfAMenuInAnOrder)
-				authorizedActiveAdmin.PATCH("/order-details/:orderDetailId/status", controllers.ChangeStatusOfAMenuInAnOrder)
-				authorizedActiveAdmin.POST("/order-details/:orderDetailId/cost", controllers.AddCostToAnOrder)
-				authorizedActiveAdmin.POST("/order-details/:orderDetailId/discount", controllers.AddDiscountToAnOrder)
-			}
+// trustedProxies lists the IPs or CIDRs in TRUSTED_PROXIES, separated by ;.
+// None are trusted when it is empty.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ";") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
 		}
 	}
+	return proxies
+}
+
+func main() {
+	models.StartNotificationWorker(10 * time.Second)
 
-	r.GET("/admin", controllers.Dashboard)
-	r.POST("/auth/login", controllers.AdminLogin)
-	r.POST("/auth/register", controllers.AdminRegister)
-	r.POST("/auth/logout", controllers.Logout)
-	r.POST("/token/refresh", controllers.Refresh)
+	r := gin.Default()
+	// the client IP limits logins and password resets, so X-Forwarded-For is
+	// only believed from the proxies in TRUSTED_PROXIES
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	r.Use(middlewares.CORS())
+	routes.Setup(r)
 
 	log.Fatal(r.Run(":" + os.Getenv("PORT")))
 }
@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+)
+
+// LoadPermissions puts the permissions of the admin of the request in the
+// context, for Permission and the controllers to check.
+func LoadPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin := c.MustGet("admin").(models.Admin)
+		permissions, err := models.GetAdminPermissions(admin.ID)
+		if err != nil {
+			c.JSON(512, gin.H{
+				"status":      "failed",
+				"errors":      err.Error(),
+				"result":      nil,
+				"description": "Gagal mengambil hak akses admin dari database.",
+			})
+			c.Abort()
+			return
+		}
+		c.Set("permissions", permissions)
+		c.Next()
+	}
+}
+
+// Permission lets the request through only when the admin has every one of
+// permissions. It needs LoadPermissions before it.
+func Permission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.MustGet("permissions").(models.PermissionSet).Has(permissions...) {
+			c.JSON(403, gin.H{
+				"status":      "failed",
+				"errors":      "Admin ini tidak memiliki hak akses " + strings.Join(permissions, ", ") + ".",
+				"result":      nil,
+				"description": "Tidak dapat melanjutkan request karena admin tidak memiliki hak akses yang dibutuhkan.",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adeindriawan/itsfood-administration/models"
+)
+
+// TwoFactorEnforced stops admins without 2FA once super admins require it for
+// everyone. They can still reach the 2FA endpoints to enroll.
+func TwoFactorEnforced() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		required, err := models.IsTwoFactorRequired()
+		if err != nil {
+			c.JSON(512, gin.H{
+				"status":      "failed",
+				"errors":      err.Error(),
+				"result":      nil,
+				"description": "Gagal mengambil pengaturan 2FA dari database.",
+			})
+			c.Abort()
+			return
+		}
+		if !required {
+			c.Next()
+			return
+		}
+
+		admin := c.MustGet("admin").(models.Admin)
+		twoFactor, err := models.GetAdminTwoFactor(admin.ID)
+		if err != nil {
+			c.JSON(512, gin.H{
+				"status":      "failed",
+				"errors":      err.Error(),
+				"result":      nil,
+				"description": "Gagal mengambil data 2FA dari admin ini.",
+			})
+			c.Abort()
+			return
+		}
+		if !twoFactor.Enabled {
+			c.JSON(403, gin.H{
+				"status":      "failed",
+				"errors":      "Admin ini belum mengaktifkan 2FA.",
+				"result":      nil,
+				"description": "Tidak dapat melanjutkan request karena semua admin wajib mengaktifkan 2FA.",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,270 @@
+package models
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+// AdminAccountError is returned when a change to an admin account is not
+// allowed, as opposed to failing in the database.
+type AdminAccountError struct {
+	Message string
+}
+
+func (e AdminAccountError) Error() string {
+	return e.Message
+}
+
+// AdminDump keeps a version of an admin from before it was changed, its
+// created_by telling who made the change which replaced it.
+type AdminDump struct {
+	ID        uint64      `gorm:"primaryKey" json:"id"`
+	SourceID  uint64      `gorm:"column:source_id;not null;index" json:"source_id"`
+	UserID    uint64      `gorm:"column:user_id;not null" json:"user_id"`
+	Name      string      `gorm:"column:name" json:"name"`
+	Email     string      `gorm:"column:email" json:"email"`
+	Phone     string      `gorm:"column:phone" json:"phone"`
+	Status    AdminStatus `gorm:"column:status" json:"status"`
+	CreatedBy string      `gorm:"column:created_by" json:"created_by"`
+	CreatedAt time.Time   `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time   `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (AdminDump) TableName() string {
+	return "__admins"
+}
+
+func newAdminDump(item Admin) AdminDump {
+	return AdminDump{
+		SourceID:  item.ID,
+		UserID:    item.UserID,
+		Name:      item.Name,
+		Email:     item.Email,
+		Phone:     item.Phone,
+		Status:    item.Status,
+		CreatedBy: item.CreatedBy,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}
+}
+
+// lockAdmin loads an admin with its user, holding the admin until tx ends.
+func lockAdmin(tx *gorm.DB, adminId uint64) (Admin, error) {
+	var admin Admin
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").First(&admin, adminId).Error
+	return admin, err
+}
+
+// updateAdmin dumps the current version of admin and then applies update to
+// it, recording by as the admin who made the change.
+func updateAdmin(tx *gorm.DB, admin *Admin, update map[string]interface{}, by Admin) error {
+	adminDump := newAdminDump(*admin)
+	if err := tx.Create(&adminDump).Error; err != nil {
+		return err
+	}
+	update["updated_at"] = time.Now()
+	update["created_by"] = by.User.Name
+	return tx.Model(admin).Updates(update).Error
+}
+
+func GetAdmin(tx *gorm.DB, adminId uint64) (Admin, error) {
+	var admin Admin
+	err := tx.Preload("User").First(&admin, adminId).Error
+	return admin, err
+}
+
+// GetAdminHistory lists the earlier versions of an admin, the latest first.
+func GetAdminHistory(tx *gorm.DB, adminId uint64) ([]AdminDump, error) {
+	var adminDumps = []AdminDump{}
+	err := tx.Where("source_id = ?", adminId).Order("id DESC").Find(&adminDumps).Error
+	return adminDumps, err
+}
+
+// AdminProfile holds the fields of an admin which can be changed, nil
+// meaning unchanged. CurrentPassword is only needed when admins change their
+// own email.
+type AdminProfile struct {
+	Name            *string
+	Email           *string
+	Phone           *string
+	CurrentPassword *string
+}
+
+// profileUpdates builds the columns to change for the admin and for its user
+// from profile. The user gets the same name, email and phone as the admin,
+// because those are what it logs in with.
+func profileUpdates(profile AdminProfile, now time.Time) (map[string]interface{}, map[string]interface{}) {
+	update := map[string]interface{}{}
+	if profile.Name != nil {
+		update["name"] = strings.TrimSpace(*profile.Name)
+	}
+	if profile.Phone != nil {
+		update["phone"] = strings.TrimSpace(*profile.Phone)
+	}
+	if profile.Email != nil {
+		update["email"] = strings.TrimSpace(*profile.Email)
+	}
+
+	userUpdate := map[string]interface{}{"updated_at": now}
+	for column, value := range update {
+		userUpdate[column] = value
+	}
+	return update, userUpdate
+}
+
+// revokeUserSessions ends the sessions of a user except keepSessionId. Tests
+// replace it to see which sessions a change to an account ends.
+var revokeUserSessions = utils.DeleteUserSessions
+
+// endAdminSessions ends the sessions of admin except keepSessionId once a
+// change to its account committed. A failure is only logged, since the change
+// itself stays.
+func endAdminSessions(admin Admin, keepSessionId string, after string) int {
+	revoked, err := revokeUserSessions(admin.UserID, keepSessionId)
+	if err != nil {
+		log.Print("Failed to revoke the sessions of admin #", admin.ID, " after ", after, ": ", err.Error())
+	}
+	return revoked
+}
+
+// UpdateAdminProfile changes the name, email or phone of an admin together
+// with its user, which keeps the same data for logging in. Admins changing
+// their own email have to give their current password. After an email change
+// the sessions made with the old one are ended, except currentSessionId of an
+// admin changing itself. db must not be in a transaction already, so the
+// sessions are only ended once the change committed.
+func UpdateAdminProfile(db *gorm.DB, adminId uint64, profile AdminProfile, by Admin, currentSessionId string) (Admin, error) {
+	var admin Admin
+	emailChanged := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		admin, err = lockAdmin(tx, adminId)
+		if err != nil {
+			return err
+		}
+
+		update, userUpdate := profileUpdates(profile, time.Now())
+		if len(update) == 0 {
+			return AdminAccountError{"tidak ada data admin yang diubah"}
+		}
+
+		if email, ok := update["email"].(string); ok && email != admin.User.Email {
+			emailChanged = true
+			if admin.ID == by.ID {
+				if profile.CurrentPassword == nil || !utils.CheckPasswordHash(*profile.CurrentPassword, admin.User.Password) {
+					return AdminAccountError{"password saat ini salah"}
+				}
+			}
+			var taken int64
+			query := tx.Model(&User{}).Where("email = ? AND id <> ?", email, admin.UserID).Count(&taken)
+			if query.Error != nil {
+				return query.Error
+			}
+			if taken > 0 {
+				return AdminAccountError{"email sudah dipakai oleh user lain"}
+			}
+		}
+
+		if err := tx.Model(&admin.User).Updates(userUpdate).Error; err != nil {
+			return err
+		}
+		if err := updateAdmin(tx, &admin, update, by); err != nil {
+			return err
+		}
+		admin, err = GetAdmin(tx, adminId)
+		return err
+	})
+	if err != nil {
+		return admin, err
+	}
+
+	if emailChanged {
+		keepSessionId := ""
+		if admin.ID == by.ID {
+			keepSessionId = currentSessionId
+		}
+		endAdminSessions(admin, keepSessionId, "an email change")
+	}
+	return admin, nil
+}
+
+// DeactivateAdmin sets an admin to Inactive and then ends all of its
+// sessions, telling how many. db must not be in a transaction already, so the
+// sessions are only ended once the change committed.
+func DeactivateAdmin(db *gorm.DB, adminId uint64, by Admin) (Admin, int, error) {
+	var admin Admin
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		admin, err = lockAdmin(tx, adminId)
+		if err != nil {
+			return err
+		}
+		if admin.ID == by.ID {
+			return AdminAccountError{"admin tidak dapat menonaktifkan dirinya sendiri"}
+		}
+		if admin.Status == Inactive {
+			return AdminAccountError{"admin sudah berstatus tidak aktif"}
+		}
+		return updateAdmin(tx, &admin, map[string]interface{}{"status": Inactive}, by)
+	})
+	if err != nil {
+		return admin, 0, err
+	}
+	admin.Status = Inactive
+	return admin, endAdminSessions(admin, "", "a deactivation"), nil
+}
+
+// ReactivateAdmin sets a deactivated admin back to Active. An admin still
+// waiting for approval or rejected has to go through the approval instead.
+func ReactivateAdmin(tx *gorm.DB, adminId uint64, by Admin) (Admin, error) {
+	admin, err := lockAdmin(tx, adminId)
+	if err != nil {
+		return admin, err
+	}
+	if admin.Status == Active {
+		return admin, AdminAccountError{"admin sudah berstatus aktif"}
+	}
+	if admin.User.Status != UserActivated {
+		return admin, AdminAccountError{"admin belum disetujui, gunakan persetujuan admin"}
+	}
+
+	if err := updateAdmin(tx, &admin, map[string]interface{}{"status": Active}, by); err != nil {
+		return admin, err
+	}
+	admin.Status = Active
+	return admin, nil
+}
+
+// ChangeAdminPassword sets a new password for an admin who knows the current
+// one, and then ends the other sessions of the admin than keepSessionId,
+// telling how many. db must not be in a transaction already, so the sessions
+// are only ended once the change committed.
+func ChangeAdminPassword(db *gorm.DB, admin Admin, currentPassword string, newPassword string, keepSessionId string) (int, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, admin.UserID).Error; err != nil {
+			return err
+		}
+		if !utils.CheckPasswordHash(currentPassword, user.Password) {
+			return AdminAccountError{"password saat ini salah"}
+		}
+		if currentPassword == newPassword {
+			return AdminAccountError{"password baru harus berbeda dengan password saat ini"}
+		}
+		hash, err := utils.HashPassword(newPassword)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{"password": hash, "updated_at": time.Now()}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return endAdminSessions(admin, keepSessionId, "a password change"), nil
+}
@@ -0,0 +1,238 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+// fakeDatabase answers the queries of the models from canned rows per table
+// and keeps every statement it was sent, so the account rules can be run
+// without MySQL.
+type fakeDatabase struct {
+	mutex      sync.Mutex
+	rows       map[string]map[string]driver.Value
+	statements []string
+}
+
+func (db *fakeDatabase) Connect(context.Context) (driver.Conn, error) { return db, nil }
+func (db *fakeDatabase) Driver() driver.Driver                        { return nil }
+
+func (db *fakeDatabase) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+func (db *fakeDatabase) Close() error              { return nil }
+func (db *fakeDatabase) Begin() (driver.Tx, error) { return db.record("BEGIN"), nil }
+func (db *fakeDatabase) Commit() error             { db.record("COMMIT"); return nil }
+func (db *fakeDatabase) Rollback() error           { db.record("ROLLBACK"); return nil }
+
+func (db *fakeDatabase) record(statement string) *fakeDatabase {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.statements = append(db.statements, statement)
+	return db
+}
+
+func (db *fakeDatabase) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db.record(query)
+	return fakeResult{}, nil
+}
+
+func (db *fakeDatabase) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	db.record(query)
+	if strings.HasPrefix(query, "SELECT count(*)") {
+		return &fakeRows{columns: []string{"count(*)"}, values: [][]driver.Value{{int64(0)}}}, nil
+	}
+	for table, row := range db.rows {
+		if !strings.Contains(query, "FROM `"+table+"`") {
+			continue
+		}
+		rows := &fakeRows{values: [][]driver.Value{{}}}
+		for column := range row {
+			rows.columns = append(rows.columns, column)
+		}
+		sort.Strings(rows.columns)
+		for _, column := range rows.columns {
+			rows.values[0] = append(rows.values[0], row[column])
+		}
+		return rows, nil
+	}
+	return &fakeRows{}, nil
+}
+
+// executed lists the statements sent to the database which start with prefix.
+func (db *fakeDatabase) executed(prefix string) []string {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	var statements []string
+	for _, statement := range db.statements {
+		if strings.HasPrefix(statement, prefix) {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// fakeResult tells every statement changed one row, which got ID 1 when it
+// was inserted.
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 1, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (rows *fakeRows) Columns() []string { return rows.columns }
+func (rows *fakeRows) Close() error      { return nil }
+
+func (rows *fakeRows) Next(dest []driver.Value) error {
+	if len(rows.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, rows.values[0])
+	rows.values = rows.values[1:]
+	return nil
+}
+
+// useFakeAdmin puts admin 7 of user 21 in status, whose password is
+// "rahasia123", in a fake database, and records the sessions the account
+// rules end instead of going to redis.
+func useFakeAdmin(t *testing.T, status AdminStatus) (*gorm.DB, *fakeDatabase, *[]string) {
+	hash, err := utils.HashPassword("rahasia123")
+	assert.NoError(t, err)
+	createdAt := time.Date(2022, 9, 1, 8, 0, 0, 0, time.UTC)
+	fake := &fakeDatabase{rows: map[string]map[string]driver.Value{
+		"admins": {
+			"id": int64(7), "user_id": int64(21), "name": []byte("Sari"), "email": []byte("sari@itsfood.id"),
+			"phone": []byte("08123456789"), "status": []byte(status), "created_by": []byte("Budi"),
+			"created_at": createdAt, "updated_at": createdAt,
+		},
+		"users": {
+			"id": int64(21), "name": []byte("Sari"), "email": []byte("sari@itsfood.id"), "password": []byte(hash),
+			"phone": []byte("08123456789"), "type": []byte("Admin"), "status": []byte(UserActivated),
+			"created_by": []byte("Budi"), "created_at": createdAt, "updated_at": createdAt,
+		},
+	}}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(fake), SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var revoked []string
+	original := revokeUserSessions
+	revokeUserSessions = func(userId uint64, keepSessionId string) (int, error) {
+		assert.Equal(t, uint64(21), userId)
+		revoked = append(revoked, keepSessionId)
+		return 2, nil
+	}
+	t.Cleanup(func() { revokeUserSessions = original })
+	return db, fake, &revoked
+}
+
+func TestOwnEmailChangeNeedsTheCurrentPassword(t *testing.T) {
+	db, fake, revoked := useFakeAdmin(t, Active)
+	self := Admin{ID: 7, User: User{Name: "Sari"}}
+	email := "sari.dewi@itsfood.id"
+	wrongPassword := "rahasia"
+
+	_, err := UpdateAdminProfile(db, 7, AdminProfile{Email: &email}, self, "session-1")
+	assert.Equal(t, AdminAccountError{"password saat ini salah"}, err)
+	_, err = UpdateAdminProfile(db, 7, AdminProfile{Email: &email, CurrentPassword: &wrongPassword}, self, "session-1")
+	assert.Equal(t, AdminAccountError{"password saat ini salah"}, err)
+	assert.Empty(t, fake.executed("UPDATE"))
+	assert.Empty(t, *revoked)
+
+	// the admin keeps the session the change was made from
+	password := "rahasia123"
+	_, err = UpdateAdminProfile(db, 7, AdminProfile{Email: &email, CurrentPassword: &password}, self, "session-1")
+	assert.NoError(t, err)
+	assert.Len(t, fake.executed("UPDATE `users`"), 1)
+	assert.Equal(t, []string{"session-1"}, *revoked)
+
+	// another admin needs no password and ends all sessions of the admin
+	other := Admin{ID: 3, User: User{Name: "Budi"}}
+	_, err = UpdateAdminProfile(db, 7, AdminProfile{Email: &email}, other, "session-9")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"session-1", ""}, *revoked)
+}
+
+func TestDeactivateAdminRevokesItsSessions(t *testing.T) {
+	db, fake, revoked := useFakeAdmin(t, Active)
+
+	admin, revokedSessions, err := DeactivateAdmin(db, 7, Admin{ID: 3, User: User{Name: "Budi"}})
+	assert.NoError(t, err)
+	assert.Equal(t, Inactive, admin.Status)
+	assert.Equal(t, 2, revokedSessions)
+	assert.Equal(t, []string{""}, *revoked)
+	assert.Equal(t, "COMMIT", fake.statements[len(fake.statements)-1])
+
+	// admins cannot lock themselves out
+	_, _, err = DeactivateAdmin(db, 7, Admin{ID: 7, User: User{Name: "Sari"}})
+	assert.Equal(t, AdminAccountError{"admin tidak dapat menonaktifkan dirinya sendiri"}, err)
+	assert.Len(t, *revoked, 1)
+}
+
+func TestChangeAdminPasswordEndsTheOtherSessions(t *testing.T) {
+	db, fake, revoked := useFakeAdmin(t, Active)
+	admin := Admin{ID: 7, UserID: 21}
+
+	_, err := ChangeAdminPassword(db, admin, "rahasia", "rahasia456", "session-1")
+	assert.Equal(t, AdminAccountError{"password saat ini salah"}, err)
+	assert.Empty(t, *revoked)
+
+	revokedSessions, err := ChangeAdminPassword(db, admin, "rahasia123", "rahasia456", "session-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, revokedSessions)
+	assert.Equal(t, []string{"session-1"}, *revoked)
+	assert.Len(t, fake.executed("UPDATE `users` SET `password`"), 1)
+}
+
+func TestEveryAdminUpdateIsDumped(t *testing.T) {
+	by := Admin{ID: 3, User: User{Name: "Budi"}}
+	name := "Sari Dewi"
+
+	db, fake, _ := useFakeAdmin(t, Active)
+	_, err := UpdateAdminProfile(db, 7, AdminProfile{Name: &name}, by, "")
+	assert.NoError(t, err)
+	assert.Len(t, fake.executed("INSERT INTO `__admins`"), 1)
+	_, _, err = DeactivateAdmin(db, 7, by)
+	assert.NoError(t, err)
+	assert.Len(t, fake.executed("INSERT INTO `__admins`"), 2)
+
+	db, fake, _ = useFakeAdmin(t, Inactive)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := ReactivateAdmin(tx, 7, by)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Len(t, fake.executed("INSERT INTO `__admins`"), 1)
+}
+
+func TestProfileUpdatesKeepTheUserInSyncWithTheAdmin(t *testing.T) {
+	name := " Sari Dewi "
+	email := "sari.dewi@itsfood.id"
+	now := time.Date(2022, 9, 2, 9, 0, 0, 0, time.UTC)
+
+	update, userUpdate := profileUpdates(AdminProfile{Name: &name, Email: &email}, now)
+	assert.Equal(t, map[string]interface{}{"name": "Sari Dewi", "email": "sari.dewi@itsfood.id"}, update)
+	assert.Equal(t, map[string]interface{}{"name": "Sari Dewi", "email": "sari.dewi@itsfood.id", "updated_at": now}, userUpdate)
+
+	update, userUpdate = profileUpdates(AdminProfile{}, now)
+	assert.Empty(t, update)
+	assert.Equal(t, map[string]interface{}{"updated_at": now}, userUpdate)
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// statuses of the users table which matter to admins
+const (
+	UserRegistered = "Registered"
+	UserActivated  = "Activated"
+	UserRejected   = "Rejected"
+)
+
+const (
+	AdminApproved = "Approved"
+	AdminRejected = "Rejected"
+)
+
+// AdminApproval records the decision on an admin who registered by itself.
+type AdminApproval struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	AdminID   uint64    `gorm:"column:admin_id;not null;index" json:"admin_id"`
+	Decision  string    `gorm:"column:decision;not null" json:"decision"`
+	Reason    string    `gorm:"column:reason;type:text" json:"reason"`
+	DecidedBy string    `gorm:"column:decided_by;not null" json:"decided_by"`
+	CreatedAt time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (AdminApproval) TableName() string {
+	return "admin_approvals"
+}
+
+// IsPendingAdmin tells whether admin registered and is still waiting for a
+// decision. A deactivated admin is Inactive as well, but its user was
+// activated before.
+func IsPendingAdmin(admin Admin) bool {
+	return admin.Status == Inactive && admin.User.Status == UserRegistered
+}
+
+func GetPendingAdmins(tx *gorm.DB) ([]Admin, error) {
+	var admins []Admin
+	err := tx.Preload("User").
+		Joins("JOIN users ON users.id = admins.user_id").
+		Where("admins.status = ? AND users.status = ?", Inactive, UserRegistered).
+		Order("admins.created_at").
+		Find(&admins).Error
+	return admins, err
+}
+
+// lockPendingAdmin loads an admin waiting for a decision, holding it until tx
+// ends so two decisions on it cannot race.
+func lockPendingAdmin(tx *gorm.DB, adminId uint64) (Admin, error) {
+	var admin Admin
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&admin, adminId).Error; err != nil {
+		return admin, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&admin.User, admin.UserID).Error; err != nil {
+		return admin, err
+	}
+	if !IsPendingAdmin(admin) {
+		return admin, AdminAccountError{"admin tidak sedang menunggu persetujuan"}
+	}
+	return admin, nil
+}
+
+// ApproveAdmin activates both the user and the admin of a pending admin, who
+// starts with the viewer role.
+func ApproveAdmin(tx *gorm.DB, adminId uint64, by Admin) (Admin, error) {
+	admin, err := lockPendingAdmin(tx, adminId)
+	if err != nil {
+		return admin, err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&admin.User).Updates(map[string]interface{}{"status": UserActivated, "updated_at": now}).Error; err != nil {
+		return admin, err
+	}
+	if err := updateAdmin(tx, &admin, map[string]interface{}{"status": Active}, by); err != nil {
+		return admin, err
+	}
+	approval := AdminApproval{AdminID: admin.ID, Decision: AdminApproved, DecidedBy: by.User.Name, CreatedAt: now}
+	if err := tx.Create(&approval).Error; err != nil {
+		return admin, err
+	}
+	// a new admin can look around, more roles are given on purpose
+	if _, err := AssignRole(tx, admin.ID, RoleViewer, by); err != nil {
+		return admin, err
+	}
+
+	admin.Status, admin.User.Status = Active, UserActivated
+	return admin, nil
+}
+
+// RejectAdmin turns down a pending admin, which then stays Inactive and
+// leaves the queue.
+func RejectAdmin(tx *gorm.DB, adminId uint64, reason string, by Admin) (Admin, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return Admin{}, AdminAccountError{"alasan penolakan harus diisi"}
+	}
+	admin, err := lockPendingAdmin(tx, adminId)
+	if err != nil {
+		return admin, err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&admin.User).Updates(map[string]interface{}{"status": UserRejected, "updated_at": now}).Error; err != nil {
+		return admin, err
+	}
+	approval := AdminApproval{AdminID: admin.ID, Decision: AdminRejected, Reason: reason, DecidedBy: by.User.Name, CreatedAt: now}
+	if err := tx.Create(&approval).Error; err != nil {
+		return admin, err
+	}
+
+	admin.User.Status = UserRejected
+	return admin, nil
+}
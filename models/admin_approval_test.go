@@ -0,0 +1,21 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPendingAdmin(t *testing.T) {
+	registered := Admin{Status: Inactive, User: User{Status: UserRegistered}}
+	assert.True(t, IsPendingAdmin(registered))
+
+	deactivated := Admin{Status: Inactive, User: User{Status: UserActivated}}
+	assert.False(t, IsPendingAdmin(deactivated))
+
+	rejected := Admin{Status: Inactive, User: User{Status: UserRejected}}
+	assert.False(t, IsPendingAdmin(rejected))
+
+	active := Admin{Status: Active, User: User{Status: UserActivated}}
+	assert.False(t, IsPendingAdmin(active))
+}
@@ -33,3 +33,16 @@ type CostDump struct {
 func (CostDump) TableName() string {
 	return "__costs"
 }
+
+func newCostDump(item Cost) CostDump {
+	return CostDump{
+		SourceID:      item.ID,
+		OrderDetailID: item.OrderDetailID,
+		Amount:        item.Amount,
+		Reason:        item.Reason,
+		Status:        item.Status,
+		CreatedAt:     item.CreatedAt,
+		UpdatedAt:     item.UpdatedAt,
+		CreatedBy:     item.CreatedBy,
+	}
+}
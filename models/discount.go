@@ -33,3 +33,16 @@ type DiscountDump struct {
 func (DiscountDump) TableName() string {
 	return "__discounts"
 }
+
+func newDiscountDump(item Discount) DiscountDump {
+	return DiscountDump{
+		SourceID:      item.ID,
+		OrderDetailID: item.OrderDetailID,
+		Amount:        item.Amount,
+		Reason:        item.Reason,
+		Status:        item.Status,
+		CreatedAt:     item.CreatedAt,
+		UpdatedAt:     item.UpdatedAt,
+		CreatedBy:     item.CreatedBy,
+	}
+}
@@ -0,0 +1,392 @@
+package models
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type HistoryEntry struct {
+	Entity    string        `json:"entity"`
+	EntityID  uint64        `json:"entity_id"`
+	Action    string        `json:"action"`
+	DumpID    uint64        `json:"dump_id"`
+	Changes   []FieldChange `json:"changes"`
+	ChangedAt time.Time     `json:"changed_at"`
+	ChangedBy string        `json:"changed_by"`
+}
+
+var orderHistoryFields = []string{
+	"OrderedBy", "OrderedFor", "OrderedTo", "NumOfMenus", "QtyOfMenus", "Amount", "Purpose", "Activity",
+	"SourceOfFund", "PaymentOption", "BilledByVendorAt", "BilledToCustomerAt", "PaidByCustomerAt", "Info", "Status",
+}
+
+var orderDetailHistoryFields = []string{
+	"MenuID", "Qty", "Price", "COGS", "Note", "ReasonForCancellation", "Status",
+}
+
+var costHistoryFields = []string{"Amount", "Reason", "Status"}
+
+// historyVersion is one version of a row, either read from its dump table or
+// the current row itself, in which case dumpID is zero.
+type historyVersion struct {
+	dumpID    uint64
+	row       interface{}
+	changedAt time.Time
+	changedBy string
+}
+
+// GetOrderHistory rebuilds a chronological timeline of changes on an order, its
+// details, and their costs and discounts from the dump tables. Every dump holds
+// the version of a row right before it was updated, so comparing consecutive
+// versions, ending with the current row, tells what each update changed.
+func GetOrderHistory(orderId uint64) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+
+	var order Order
+	if err := services.DB.First(&order, orderId).Error; err != nil {
+		return nil, err
+	}
+	var orderDumps []OrderDump
+	if err := services.DB.Where("source_id = ?", orderId).Order("id").Find(&orderDumps).Error; err != nil {
+		return nil, err
+	}
+	var orderVersions []historyVersion
+	for _, item := range orderDumps {
+		orderVersions = append(orderVersions, historyVersion{item.ID, item, item.UpdatedAt, item.CreatedBy})
+	}
+	orderVersions = append(orderVersions, historyVersion{0, newOrderDump(order), order.UpdatedAt, order.CreatedBy})
+	entries = append(entries, buildHistory("order", orderId, orderVersions, orderHistoryFields, true)...)
+
+	var orderDetails []OrderDetail
+	if err := services.DB.Where("order_id = ?", orderId).Order("id").Find(&orderDetails).Error; err != nil {
+		return nil, err
+	}
+	var orderDetailDumps []OrderDetailDump
+	if err := services.DB.Where("order_id = ?", orderId).Order("id").Find(&orderDetailDumps).Error; err != nil {
+		return nil, err
+	}
+	orderDetailVersions := map[uint64][]historyVersion{}
+	var orderDetailIds []uint64
+	for _, item := range orderDetailDumps {
+		if _, ok := orderDetailVersions[item.SourceID]; !ok {
+			orderDetailIds = append(orderDetailIds, item.SourceID)
+		}
+		orderDetailVersions[item.SourceID] = append(orderDetailVersions[item.SourceID], historyVersion{item.ID, item, item.UpdatedAt, item.CreatedBy})
+	}
+	existingOrderDetails := map[uint64]bool{}
+	for _, item := range orderDetails {
+		if _, ok := orderDetailVersions[item.ID]; !ok {
+			orderDetailIds = append(orderDetailIds, item.ID)
+		}
+		existingOrderDetails[item.ID] = true
+		orderDetailVersions[item.ID] = append(orderDetailVersions[item.ID], historyVersion{0, newOrderDetailDump(item), item.UpdatedAt, item.CreatedBy})
+	}
+	for _, id := range orderDetailIds {
+		entries = append(entries, buildHistory("order_detail", id, orderDetailVersions[id], orderDetailHistoryFields, existingOrderDetails[id])...)
+	}
+
+	if len(orderDetailIds) > 0 {
+		var costs []Cost
+		var costDumps []CostDump
+		if err := services.DB.Where("order_detail_id IN ?", orderDetailIds).Order("id").Find(&costs).Error; err != nil {
+			return nil, err
+		}
+		if err := services.DB.Where("order_detail_id IN ?", orderDetailIds).Order("id").Find(&costDumps).Error; err != nil {
+			return nil, err
+		}
+		costVersions := map[uint64][]historyVersion{}
+		for _, item := range costDumps {
+			costVersions[item.SourceID] = append(costVersions[item.SourceID], historyVersion{item.ID, item, item.UpdatedAt, item.CreatedBy})
+		}
+		existingCosts := map[uint64]bool{}
+		for _, item := range costs {
+			existingCosts[item.ID] = true
+			costVersions[item.ID] = append(costVersions[item.ID], historyVersion{0, newCostDump(item), item.UpdatedAt, item.CreatedBy})
+		}
+		entries = append(entries, buildHistories("cost", costVersions, costHistoryFields, existingCosts)...)
+
+		var discounts []Discount
+		var discountDumps []DiscountDump
+		if err := services.DB.Where("order_detail_id IN ?", orderDetailIds).Order("id").Find(&discounts).Error; err != nil {
+			return nil, err
+		}
+		if err := services.DB.Where("order_detail_id IN ?", orderDetailIds).Order("id").Find(&discountDumps).Error; err != nil {
+			return nil, err
+		}
+		discountVersions := map[uint64][]historyVersion{}
+		for _, item := range discountDumps {
+			discountVersions[item.SourceID] = append(discountVersions[item.SourceID], historyVersion{item.ID, item, item.UpdatedAt, item.CreatedBy})
+		}
+		existingDiscounts := map[uint64]bool{}
+		for _, item := range discounts {
+			existingDiscounts[item.ID] = true
+			discountVersions[item.ID] = append(discountVersions[item.ID], historyVersion{0, newDiscountDump(item), item.UpdatedAt, item.CreatedBy})
+		}
+		entries = append(entries, buildHistories("discount", discountVersions, costHistoryFields, existingDiscounts)...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ChangedAt.Before(entries[j].ChangedAt)
+	})
+
+	return entries, nil
+}
+
+// buildHistories builds the history of every row in versions, going through
+// the rows by ID so that entries changed at the same time always come in the
+// same order.
+func buildHistories(entity string, versions map[uint64][]historyVersion, fields []string, existing map[uint64]bool) []HistoryEntry {
+	var ids []uint64
+	for id := range versions {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var entries []HistoryEntry
+	for _, id := range ids {
+		entries = append(entries, buildHistory(entity, id, versions[id], fields, existing[id])...)
+	}
+	return entries
+}
+
+// buildHistory turns the versions of one row, oldest first, into history
+// entries. The first version is reported as the creation of the row, and when
+// the row no longer exists its last version is reported as the deletion.
+func buildHistory(entity string, entityId uint64, versions []historyVersion, fields []string, exists bool) []HistoryEntry {
+	var entries []HistoryEntry
+	if len(versions) == 0 {
+		return entries
+	}
+
+	first := versions[0]
+	createdAt := reflect.ValueOf(first.row).FieldByName("CreatedAt").Interface().(time.Time)
+	entries = append(entries, HistoryEntry{
+		Entity:    entity,
+		EntityID:  entityId,
+		Action:    "created",
+		DumpID:    first.dumpID,
+		Changes:   diffFields(nil, first.row, fields),
+		ChangedAt: createdAt,
+		ChangedBy: first.changedBy,
+	})
+
+	for i := 1; i < len(versions); i++ {
+		changes := diffFields(versions[i-1].row, versions[i].row, fields)
+		if len(changes) == 0 {
+			continue
+		}
+		entries = append(entries, HistoryEntry{
+			Entity:    entity,
+			EntityID:  entityId,
+			Action:    "updated",
+			DumpID:    versions[i-1].dumpID,
+			Changes:   changes,
+			ChangedAt: versions[i].changedAt,
+			ChangedBy: versions[i].changedBy,
+		})
+	}
+
+	if !exists {
+		last := versions[len(versions)-1]
+		entries = append(entries, HistoryEntry{
+			Entity:    entity,
+			EntityID:  entityId,
+			Action:    "deleted",
+			DumpID:    last.dumpID,
+			ChangedAt: last.changedAt,
+			ChangedBy: last.changedBy,
+		})
+	}
+
+	return entries
+}
+
+// diffFields compares the given fields of two versions of the same row. A nil
+// before lists every field of after as a change from nothing.
+func diffFields(before interface{}, after interface{}, fields []string) []FieldChange {
+	var changes []FieldChange
+	afterValue := reflect.ValueOf(after)
+	afterType := afterValue.Type()
+
+	for _, field := range fields {
+		structField, _ := afterType.FieldByName(field)
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+		to := afterValue.FieldByName(field).Interface()
+		if before == nil {
+			changes = append(changes, FieldChange{Field: name, From: nil, To: to})
+			continue
+		}
+
+		from := reflect.ValueOf(before).FieldByName(field).Interface()
+		if fromTime, ok := from.(time.Time); ok {
+			if fromTime.Equal(to.(time.Time)) {
+				continue
+			}
+		} else if reflect.DeepEqual(from, to) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: name, From: from, To: to})
+	}
+
+	return changes
+}
+
+// restorableOrderFields leaves out the totals and status, which RecountOrder
+// derives from the details, and the billing & payment dates, which belong to
+// the billing flow.
+var restorableOrderFields = []string{
+	"OrderedBy", "OrderedFor", "OrderedTo", "Purpose", "Activity", "SourceOfFund", "PaymentOption", "Info",
+}
+
+// RestoreOrder rolls an order back to the version kept in the given dump. The
+// current version is dumped first by UpdateOrder, so the restore can itself be
+// restored.
+func RestoreOrder(tx *gorm.DB, dumpId uint64, restoredBy string) (OrderDump, []FieldChange, error) {
+	var orderDump OrderDump
+	if err := tx.First(&orderDump, dumpId).Error; err != nil {
+		return orderDump, nil, err
+	}
+	var order Order
+	if err := tx.First(&order, orderDump.SourceID).Error; err != nil {
+		return orderDump, nil, err
+	}
+	if order.Status.IsFinal() {
+		return orderDump, nil, TransitionError{Entity: "order", From: string(order.Status), To: string(orderDump.Status)}
+	}
+
+	changes := diffFields(newOrderDump(order), orderDump, restorableOrderFields)
+	if len(changes) == 0 {
+		return orderDump, changes, nil
+	}
+	err := UpdateOrder(tx, map[string]interface{}{"id": order.ID}, map[string]interface{}{
+		"ordered_by":     orderDump.OrderedBy,
+		"ordered_for":    orderDump.OrderedFor,
+		"ordered_to":     orderDump.OrderedTo,
+		"purpose":        orderDump.Purpose,
+		"activity":       orderDump.Activity,
+		"source_of_fund": orderDump.SourceOfFund,
+		"payment_option": orderDump.PaymentOption,
+		"info":           orderDump.Info,
+		"updated_at":     time.Now(),
+		"created_by":     restoredBy,
+	})
+
+	return orderDump, changes, err
+}
+
+// RestoreOrderDetail rolls an order detail back to the version kept in the
+// given dump and recounts its order. A detail which has been deleted is put
+// back with its original ID, in a status a new detail could move to. The
+// status is only restored when the transition table allows it, so a
+// cancellation cannot be undone this way. The restored detail is held to the
+// ordering rules like any other change, unless overrideReason is given.
+func RestoreOrderDetail(tx *gorm.DB, dumpId uint64, overrideReason string, restoredBy string) (OrderDetailDump, []FieldChange, []RuleViolation, error) {
+	var orderDetailDump OrderDetailDump
+	if err := tx.First(&orderDetailDump, dumpId).Error; err != nil {
+		return orderDetailDump, nil, nil, err
+	}
+	var order Order
+	if err := tx.First(&order, orderDetailDump.OrderID).Error; err != nil {
+		return orderDetailDump, nil, nil, err
+	}
+	if order.Status.IsFinal() {
+		return orderDetailDump, nil, nil, TransitionError{Entity: "order", From: string(order.Status), To: string(OrderCreated)}
+	}
+
+	var orderDetails []OrderDetail
+	if err := tx.Where("id = ?", orderDetailDump.SourceID).Find(&orderDetails).Error; err != nil {
+		return orderDetailDump, nil, nil, err
+	}
+
+	var changes []FieldChange
+	var violations []RuleViolation
+	var err error
+	if len(orderDetails) == 0 {
+		if !orderDetailDump.Status.IsNewDetailStatus() {
+			return orderDetailDump, nil, nil, TransitionError{Entity: "detail order", From: string(OrderDetailCreated), To: string(orderDetailDump.Status)}
+		}
+		if orderDetailDump.Status != OrderDetailCancelled {
+			violations, err = CheckOrderLineChange(tx, order.ID, orderDetailDump.SourceID, orderDetailDump.MenuID, orderDetailDump.Qty)
+			if err != nil {
+				return orderDetailDump, nil, nil, err
+			}
+		}
+		if err := CheckRuleOverride(tx, order.ID, orderDetailDump.SourceID, violations, overrideReason, restoredBy); err != nil {
+			return orderDetailDump, nil, violations, err
+		}
+
+		changes = diffFields(nil, orderDetailDump, orderDetailHistoryFields)
+		orderDetail := OrderDetail{
+			ID:                    orderDetailDump.SourceID,
+			OrderID:               orderDetailDump.OrderID,
+			MenuID:                orderDetailDump.MenuID,
+			Qty:                   orderDetailDump.Qty,
+			Price:                 orderDetailDump.Price,
+			COGS:                  orderDetailDump.COGS,
+			Note:                  orderDetailDump.Note,
+			ReasonForCancellation: orderDetailDump.ReasonForCancellation,
+			Status:                orderDetailDump.Status,
+			CreatedAt:             orderDetailDump.CreatedAt,
+			UpdatedAt:             time.Now(),
+			CreatedBy:             restoredBy,
+		}
+		if err := CreateOrderDetail(tx, &orderDetail); err != nil {
+			return orderDetailDump, nil, violations, err
+		}
+	} else {
+		orderDetail := orderDetails[0]
+		if orderDetail.Status != orderDetailDump.Status && !orderDetail.Status.CanTransitionTo(orderDetailDump.Status) {
+			return orderDetailDump, nil, nil, TransitionError{Entity: "detail order", From: string(orderDetail.Status), To: string(orderDetailDump.Status)}
+		}
+		changes = diffFields(newOrderDetailDump(orderDetail), orderDetailDump, orderDetailHistoryFields)
+		if len(changes) == 0 {
+			return orderDetailDump, changes, nil, nil
+		}
+
+		if orderDetailDump.Status == OrderDetailCancelled && orderDetail.Status != OrderDetailCancelled {
+			violations, err = CheckOrderLineRemoval(tx, order.ID, orderDetail.ID)
+		} else if orderDetailDump.MenuID != orderDetail.MenuID || orderDetailDump.Qty != orderDetail.Qty {
+			violations, err = CheckOrderLineChange(tx, order.ID, orderDetail.ID, orderDetailDump.MenuID, orderDetailDump.Qty)
+		}
+		if err != nil {
+			return orderDetailDump, nil, nil, err
+		}
+		if err := CheckRuleOverride(tx, order.ID, orderDetail.ID, violations, overrideReason, restoredBy); err != nil {
+			return orderDetailDump, nil, violations, err
+		}
+
+		err = UpdateOrderDetail(tx, map[string]interface{}{"id": orderDetail.ID}, map[string]interface{}{
+			"menu_id":                 orderDetailDump.MenuID,
+			"qty":                     orderDetailDump.Qty,
+			"price":                   orderDetailDump.Price,
+			"cogs":                    orderDetailDump.COGS,
+			"note":                    orderDetailDump.Note,
+			"reason_for_cancellation": orderDetailDump.ReasonForCancellation,
+			"status":                  orderDetailDump.Status,
+			"updated_at":              time.Now(),
+			"created_by":              restoredBy,
+		})
+		if err != nil {
+			return orderDetailDump, nil, violations, err
+		}
+	}
+
+	if _, err := RecountOrder(tx, orderDetailDump.OrderID, restoredBy); err != nil {
+		return orderDetailDump, changes, violations, err
+	}
+
+	return orderDetailDump, changes, violations, nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildHistoriesOrdersRowsById(t *testing.T) {
+	at := time.Date(2022, 9, 1, 8, 0, 0, 0, time.UTC)
+	versions := map[uint64][]historyVersion{}
+	for _, id := range []uint64{9, 3, 5, 1, 7} {
+		versions[id] = []historyVersion{{0, CostDump{SourceID: id, Amount: 5000, Reason: "Ongkir", Status: "Active"}, at, "Budi"}}
+	}
+	existing := map[uint64]bool{1: true, 3: true, 5: true, 7: true, 9: true}
+
+	for i := 0; i < 10; i++ {
+		var ids []uint64
+		for _, entry := range buildHistories("cost", versions, costHistoryFields, existing) {
+			ids = append(ids, entry.EntityID)
+		}
+		assert.Equal(t, []uint64{1, 3, 5, 7, 9}, ids)
+	}
+}
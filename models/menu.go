@@ -3,6 +3,8 @@ package models
 import (
 	"database/sql/driver"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type MenuCategory string
@@ -46,3 +48,70 @@ type Menu struct {
 	CreatedAt      time.Time    `gorm:"column:created_at;not null" json:"created_at"`
 	UpdatedAt      time.Time    `gorm:"autoUpdateTime:false" json:"updated_at"`
 }
+
+// MenuPrice records one change to the prices of a menu, so an order detail can
+// be checked against what the catalogue said when it was ordered.
+type MenuPrice struct {
+	ID                uint64    `gorm:"primaryKey" json:"id"`
+	MenuID            uint64    `gorm:"column:menu_id;not null;index" json:"menu_id"`
+	OldCOGS           uint      `gorm:"column:old_cogs;not null" json:"old_cogs"`
+	NewCOGS           uint      `gorm:"column:new_cogs;not null" json:"new_cogs"`
+	OldRetailPrice    uint      `gorm:"column:old_retail_price;not null" json:"old_retail_price"`
+	NewRetailPrice    uint      `gorm:"column:new_retail_price;not null" json:"new_retail_price"`
+	OldWholesalePrice uint      `gorm:"column:old_wholesale_price;not null" json:"old_wholesale_price"`
+	NewWholesalePrice uint      `gorm:"column:new_wholesale_price;not null" json:"new_wholesale_price"`
+	OldDiscount       float64   `gorm:"column:old_discount;not null" json:"old_discount"`
+	NewDiscount       float64   `gorm:"column:new_discount;not null" json:"new_discount"`
+	ChangedAt         time.Time `gorm:"column:changed_at;not null" json:"changed_at"`
+	ChangedBy         string    `gorm:"column:changed_by;not null" json:"changed_by"`
+}
+
+func (MenuPrice) TableName() string {
+	return "menu_prices"
+}
+
+// UpdateMenu applies update to a menu and, when it changes any of the prices,
+// records the old and new prices in menu_prices in the same transaction.
+func UpdateMenu(tx *gorm.DB, menuId uint64, update map[string]interface{}, changedBy string) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var menu Menu
+		if err := tx.First(&menu, menuId).Error; err != nil {
+			return err
+		}
+
+		price := MenuPrice{
+			MenuID:            menu.ID,
+			OldCOGS:           menu.COGS,
+			NewCOGS:           menu.COGS,
+			OldRetailPrice:    menu.RetailPrice,
+			NewRetailPrice:    menu.RetailPrice,
+			OldWholesalePrice: menu.WholesalePrice,
+			NewWholesalePrice: menu.WholesalePrice,
+			OldDiscount:       menu.Discount,
+			NewDiscount:       menu.Discount,
+			ChangedBy:         changedBy,
+		}
+		if cogs, ok := update["cogs"].(uint); ok {
+			price.NewCOGS = cogs
+		}
+		if retailPrice, ok := update["retail_price"].(uint); ok {
+			price.NewRetailPrice = retailPrice
+		}
+		if wholesalePrice, ok := update["wholesale_price"].(uint); ok {
+			price.NewWholesalePrice = wholesalePrice
+		}
+		if discount, ok := update["discount"].(float64); ok {
+			price.NewDiscount = discount
+		}
+
+		if price.OldCOGS != price.NewCOGS || price.OldRetailPrice != price.NewRetailPrice ||
+			price.OldWholesalePrice != price.NewWholesalePrice || price.OldDiscount != price.NewDiscount {
+			price.ChangedAt = time.Now()
+			if err := tx.Create(&price).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&menu).Updates(update).Error
+	})
+}
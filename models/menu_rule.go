@@ -0,0 +1,267 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	RuleMenuInactive         = "menu_inactive"
+	RuleVendorInactive       = "vendor_inactive"
+	RuleMinOrderQty          = "min_order_qty"
+	RuleMaxOrderQty          = "max_order_qty"
+	RulePreOrder             = "pre_order"
+	RuleVendorMinOrderQty    = "vendor_min_order_qty"
+	RuleVendorMinOrderAmount = "vendor_min_order_amount"
+)
+
+// RuleViolation is one ordering rule of a menu or a vendor which an order
+// would break.
+type RuleViolation struct {
+	Rule     string `json:"rule"`
+	MenuID   uint64 `json:"menu_id,omitempty"`
+	VendorID uint64 `json:"vendor_id"`
+	Message  string `json:"message"`
+}
+
+// RuleViolationError is returned when an order change breaks ordering rules
+// and nobody overrode them.
+type RuleViolationError struct {
+	Violations []RuleViolation
+}
+
+func (e RuleViolationError) Error() string {
+	var messages []string
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return "aturan order menu dilanggar: " + strings.Join(messages, "; ")
+}
+
+// OrderLine is a menu of an order as it would be after a change. Menu has to
+// come with its Vendor. Changed marks the lines which are being added or
+// edited; only those are checked against the rules of their menu.
+type OrderLine struct {
+	OrderDetailID uint64
+	Menu          Menu
+	Qty           uint
+	COGS          uint64
+	Changed       bool
+}
+
+// ValidateOrderLines checks the lines of an order delivered at orderedFor
+// against the ordering rules. The rules of a menu are checked on the changed
+// lines, and the minimums of a vendor on the lines of every vendor in
+// vendorIds. A vendor without any line left is not checked, since it is no
+// longer part of the order.
+func ValidateOrderLines(orderedFor time.Time, lines []OrderLine, vendorIds []uint64, now time.Time) []RuleViolation {
+	var violations []RuleViolation
+	for _, line := range lines {
+		if !line.Changed {
+			continue
+		}
+		menu := line.Menu
+		vendorId := uint64(menu.VendorID)
+		if menu.Status != "Active" {
+			violations = append(violations, RuleViolation{
+				Rule:     RuleMenuInactive,
+				MenuID:   menu.ID,
+				VendorID: vendorId,
+				Message:  fmt.Sprintf("Menu %s sedang tidak aktif.", menu.Name),
+			})
+		}
+		if menu.Vendor.Status != "" && menu.Vendor.Status != "Active" {
+			violations = append(violations, RuleViolation{
+				Rule:     RuleVendorInactive,
+				MenuID:   menu.ID,
+				VendorID: vendorId,
+				Message:  fmt.Sprintf("Vendor dari menu %s sedang tidak aktif.", menu.Name),
+			})
+		}
+		if line.Qty < menu.MinOrderQty {
+			violations = append(violations, RuleViolation{
+				Rule:     RuleMinOrderQty,
+				MenuID:   menu.ID,
+				VendorID: vendorId,
+				Message:  fmt.Sprintf("Menu %s minimal dipesan %d porsi.", menu.Name, menu.MinOrderQty),
+			})
+		}
+		if menu.MaxOrderQty > 0 && line.Qty > menu.MaxOrderQty {
+			violations = append(violations, RuleViolation{
+				Rule:     RuleMaxOrderQty,
+				MenuID:   menu.ID,
+				VendorID: vendorId,
+				Message:  fmt.Sprintf("Menu %s maksimal dipesan %d porsi.", menu.Name, menu.MaxOrderQty),
+			})
+		}
+		leadTime := time.Duration(menu.PreOrderDays)*24*time.Hour + time.Duration(menu.PreOrderHours)*time.Hour
+		if leadTime > 0 && orderedFor.Sub(now) < leadTime {
+			violations = append(violations, RuleViolation{
+				Rule:     RulePreOrder,
+				MenuID:   menu.ID,
+				VendorID: vendorId,
+				Message:  fmt.Sprintf("Menu %s harus dipesan %d hari %d jam sebelum diantar.", menu.Name, menu.PreOrderDays, menu.PreOrderHours),
+			})
+		}
+	}
+
+	for _, vendorId := range vendorIds {
+		var vendor Vendor
+		var qty uint
+		var amount uint64
+		var hasLines bool
+		for _, line := range lines {
+			if uint64(line.Menu.VendorID) != vendorId {
+				continue
+			}
+			vendor = line.Menu.Vendor
+			hasLines = true
+			qty += line.Qty
+			amount += line.COGS * uint64(line.Qty)
+		}
+		if !hasLines {
+			continue
+		}
+		if qty < vendor.VendorMinOrderQty {
+			violations = append(violations, RuleViolation{
+				Rule:     RuleVendorMinOrderQty,
+				VendorID: vendorId,
+				Message:  fmt.Sprintf("Order ke vendor %s minimal %d porsi, saat ini %d porsi.", vendor.User.Name, vendor.VendorMinOrderQty, qty),
+			})
+		}
+		if amount < uint64(vendor.VendorMinOrderAmount) {
+			violations = append(violations, RuleViolation{
+				Rule:     RuleVendorMinOrderAmount,
+				VendorID: vendorId,
+				Message:  fmt.Sprintf("Order ke vendor %s minimal Rp%d, saat ini Rp%d.", vendor.User.Name, vendor.VendorMinOrderAmount, amount),
+			})
+		}
+	}
+
+	return violations
+}
+
+// lockOrderLines locks an order and loads the details which count toward
+// its ordering rules, so concurrent changes to the same order are checked one
+// after another, each on what the previous one wrote.
+func lockOrderLines(tx *gorm.DB, orderId uint64) (Order, []OrderDetail, error) {
+	var order Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderId).Error; err != nil {
+		return order, nil, err
+	}
+	var orderDetails []OrderDetail
+	err := tx.Preload("Menu.Vendor.User").
+		Where("order_id = ?", orderId).
+		Where("status != ?", OrderDetailCancelled).
+		Find(&orderDetails).Error
+	return order, orderDetails, err
+}
+
+// validateOrderLineChange checks an order as it would be after its detail
+// orderDetailId is set to qty portions of menu, or after a new detail when
+// orderDetailId is not one of orderDetails.
+func validateOrderLineChange(order Order, orderDetails []OrderDetail, orderDetailId uint64, menu Menu, qty uint, now time.Time) []RuleViolation {
+	vendorIds := []uint64{uint64(menu.VendorID)}
+	var lines []OrderLine
+	for _, od := range orderDetails {
+		if od.ID == orderDetailId {
+			if od.Menu.VendorID != menu.VendorID {
+				vendorIds = append(vendorIds, uint64(od.Menu.VendorID))
+			}
+			continue
+		}
+		lines = append(lines, OrderLine{OrderDetailID: od.ID, Menu: od.Menu, Qty: od.Qty, COGS: od.COGS})
+	}
+	lines = append(lines, OrderLine{OrderDetailID: orderDetailId, Menu: menu, Qty: qty, COGS: uint64(menu.COGS), Changed: true})
+
+	return ValidateOrderLines(order.OrderedFor, lines, vendorIds, now)
+}
+
+// validateOrderLineRemoval checks the minimums of the vendor of detail
+// orderDetailId on the lines which would be left without it.
+func validateOrderLineRemoval(order Order, orderDetails []OrderDetail, orderDetailId uint64, now time.Time) []RuleViolation {
+	var vendorIds []uint64
+	var lines []OrderLine
+	for _, od := range orderDetails {
+		if od.ID == orderDetailId {
+			vendorIds = append(vendorIds, uint64(od.Menu.VendorID))
+			continue
+		}
+		lines = append(lines, OrderLine{OrderDetailID: od.ID, Menu: od.Menu, Qty: od.Qty, COGS: od.COGS})
+	}
+	return ValidateOrderLines(order.OrderedFor, lines, vendorIds, now)
+}
+
+// CheckOrderLineChange validates an order as it would be after its detail
+// orderDetailId is set to qty portions of menuId. An orderDetailId of 0 checks
+// a new detail being added. The vendor the detail is moved away from is
+// checked too, so it is not left below its minimums. It has to run in the
+// transaction which then makes the change.
+func CheckOrderLineChange(tx *gorm.DB, orderId uint64, orderDetailId uint64, menuId uint64, qty uint) ([]RuleViolation, error) {
+	order, orderDetails, err := lockOrderLines(tx, orderId)
+	if err != nil {
+		return nil, err
+	}
+	var menu Menu
+	if err := tx.Preload("Vendor.User").First(&menu, menuId).Error; err != nil {
+		return nil, err
+	}
+	return validateOrderLineChange(order, orderDetails, orderDetailId, menu, qty, time.Now()), nil
+}
+
+// CheckOrderLineRemoval validates an order as it would be after its detail
+// orderDetailId is deleted or cancelled, which can leave its vendor below
+// the minimums. It has to run in the transaction which then removes it.
+func CheckOrderLineRemoval(tx *gorm.DB, orderId uint64, orderDetailId uint64) ([]RuleViolation, error) {
+	order, orderDetails, err := lockOrderLines(tx, orderId)
+	if err != nil {
+		return nil, err
+	}
+	return validateOrderLineRemoval(order, orderDetails, orderDetailId, time.Now()), nil
+}
+
+// RuleOverride records an admin going ahead with an order change which broke
+// ordering rules, and why.
+type RuleOverride struct {
+	ID            uint64    `gorm:"primaryKey" json:"id"`
+	OrderID       uint64    `gorm:"column:order_id;not null;index" json:"order_id"`
+	OrderDetailID uint64    `gorm:"column:order_detail_id;not null" json:"order_detail_id"`
+	Violations    string    `gorm:"column:violations;type:text;not null" json:"violations"`
+	Reason        string    `gorm:"column:reason;not null" json:"reason"`
+	CreatedBy     string    `gorm:"column:created_by;not null" json:"created_by"`
+	CreatedAt     time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (RuleOverride) TableName() string {
+	return "order_rule_overrides"
+}
+
+// CheckRuleOverride lets violations through only when an override reason is
+// given, and then records the override. Without violations it does nothing.
+func CheckRuleOverride(tx *gorm.DB, orderId uint64, orderDetailId uint64, violations []RuleViolation, reason string, by string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	if strings.TrimSpace(reason) == "" {
+		return RuleViolationError{Violations: violations}
+	}
+
+	encodedViolations, err := json.Marshal(violations)
+	if err != nil {
+		return err
+	}
+	override := RuleOverride{
+		OrderID:       orderId,
+		OrderDetailID: orderDetailId,
+		Violations:    string(encodedViolations),
+		Reason:        reason,
+		CreatedBy:     by,
+		CreatedAt:     time.Now(),
+	}
+	return tx.Create(&override).Error
+}
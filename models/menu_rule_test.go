@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOrderLines(t *testing.T) {
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	vendor := Vendor{ID: 7, Status: "Active", VendorMinOrderQty: 10, VendorMinOrderAmount: 100000}
+	menu := Menu{ID: 3, Name: "Nasi Kotak", Status: "Active", MinOrderQty: 5, MaxOrderQty: 50, PreOrderDays: 1, VendorID: 7, Vendor: vendor}
+	rules := func(violations []RuleViolation) []string {
+		var rules []string
+		for _, violation := range violations {
+			rules = append(rules, violation.Rule)
+		}
+		return rules
+	}
+
+	lines := []OrderLine{{Menu: menu, Qty: 20, COGS: 10000, Changed: true}}
+	assert.Empty(t, ValidateOrderLines(now.Add(48*time.Hour), lines, []uint64{7}, now))
+
+	lines = []OrderLine{{Menu: menu, Qty: 3, COGS: 10000, Changed: true}}
+	assert.Equal(t, []string{RuleMinOrderQty, RulePreOrder, RuleVendorMinOrderQty, RuleVendorMinOrderAmount},
+		rules(ValidateOrderLines(now.Add(2*time.Hour), lines, []uint64{7}, now)))
+
+	// only the changed lines are held to the rules of their menu
+	inactiveMenu := menu
+	inactiveMenu.Status = "Inactive"
+	lines = []OrderLine{
+		{Menu: inactiveMenu, Qty: 60, COGS: 10000},
+		{Menu: menu, Qty: 51, COGS: 10000, Changed: true},
+	}
+	assert.Equal(t, []string{RuleMaxOrderQty}, rules(ValidateOrderLines(now.Add(48*time.Hour), lines, []uint64{7}, now)))
+
+	// a vendor without lines is not held to its minimums
+	assert.Empty(t, ValidateOrderLines(now.Add(48*time.Hour), nil, []uint64{7}, now))
+}
+
+func TestValidateOrderLineRemoval(t *testing.T) {
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local)
+	order := Order{ID: 1, OrderedFor: now.Add(48 * time.Hour)}
+	vendor := Vendor{ID: 7, Status: "Active", VendorMinOrderQty: 10}
+	menu := Menu{ID: 3, Name: "Nasi Kotak", Status: "Active", VendorID: 7, Vendor: vendor}
+	orderDetails := []OrderDetail{
+		{ID: 11, OrderID: 1, MenuID: 3, Menu: menu, Qty: 6, COGS: 10000},
+		{ID: 12, OrderID: 1, MenuID: 3, Menu: menu, Qty: 6, COGS: 10000},
+	}
+
+	// the vendor is left with 6 portions of its minimum 10
+	violations := validateOrderLineRemoval(order, orderDetails, 12, now)
+	if assert.Len(t, violations, 1) {
+		assert.Equal(t, RuleVendorMinOrderQty, violations[0].Rule)
+	}
+
+	// removing the last line of the vendor takes it out of the order
+	assert.Empty(t, validateOrderLineRemoval(order, orderDetails[:1], 11, now))
+
+	// growing a line back over the minimum is fine
+	assert.Empty(t, validateOrderLineChange(order, orderDetails[:1], 11, menu, 10, now))
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+const (
+	NotificationPending = "Pending"
+	NotificationSending = "Sending"
+	NotificationSent    = "Sent"
+	NotificationDead    = "Dead"
+)
+
+const (
+	// a notification which still fails after this many attempts is moved to
+	// the dead-letter list and waits for an admin to retry it
+	notificationMaxAttempts = 8
+	notificationBaseBackoff = 30 * time.Second
+	notificationMaxBackoff  = time.Hour
+	// a notification left Sending this long belongs to a worker which died
+	notificationSendingTimeout = 5 * time.Minute
+	notificationBatchSize      = 20
+)
+
+// Notification is a message in the outbox. It is stored first and delivered
+// by the notification worker, so it survives a restart and is retried when
+// its channel fails.
+type Notification struct {
+	ID            uint64     `gorm:"primaryKey" json:"id"`
+	Channel       string     `gorm:"column:channel;not null" json:"channel"`
+	Recipient     string     `gorm:"column:recipient" json:"recipient"`
+	Subject       string     `gorm:"column:subject" json:"subject"`
+	Body          string     `gorm:"column:body;type:text;not null" json:"body"`
+	Status        string     `gorm:"column:status;not null;index:idx_notifications_due,priority:1" json:"status"`
+	Attempts      uint       `gorm:"column:attempts;not null" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;not null;index:idx_notifications_due,priority:2" json:"next_attempt_at"`
+	LastError     string     `gorm:"column:last_error;type:text" json:"last_error"`
+	SentAt        *time.Time `gorm:"column:sent_at" json:"sent_at"`
+	CreatedAt     time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at;not null" json:"updated_at"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// QueueNotification puts a message in the outbox on tx, so a notification about
+// a change is only sent when the transaction making the change commits.
+func QueueNotification(tx *gorm.DB, channel string, recipient string, subject string, body string) error {
+	if _, ok := services.GetNotifier(channel); !ok {
+		return errors.New("kanal notifikasi " + channel + " tidak dikenal")
+	}
+	now := time.Now()
+	notification := Notification{
+		Channel:       channel,
+		Recipient:     recipient,
+		Subject:       subject,
+		Body:          body,
+		Status:        NotificationPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	return tx.Create(&notification).Error
+}
+
+// Notify queues a message outside of any transaction. A notification is never
+// worth failing a request for, so an error is only logged.
+func Notify(channel string, recipient string, subject string, body string) {
+	if err := QueueNotification(services.DB, channel, recipient, subject, body); err != nil {
+		log.Print("Failed to queue ", channel, " notification: ", err.Error())
+	}
+}
+
+// NotifyGroup queues a message for the telegram group of the admins.
+func NotifyGroup(text string) {
+	Notify(services.ChannelTelegram, "", "", text)
+}
+
+// notificationBackoff is how long to wait before the next attempt after the
+// given number of failed ones: 30 seconds, doubled every attempt, up to an hour.
+func notificationBackoff(attempts uint) time.Duration {
+	backoff := notificationBaseBackoff
+	for i := uint(1); i < attempts; i++ {
+		backoff *= 2
+		if backoff >= notificationMaxBackoff {
+			return notificationMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// claimNotification marks a due notification as being sent. It fails when
+// another worker claimed it first.
+func claimNotification(notification *Notification, now time.Time) bool {
+	claim := services.DB.Model(&Notification{}).
+		Where("id = ? AND status = ? AND updated_at = ?", notification.ID, notification.Status, notification.UpdatedAt).
+		Updates(map[string]interface{}{"status": NotificationSending, "updated_at": now})
+	if claim.Error != nil {
+		log.Print("Failed to claim notification #", notification.ID, ": ", claim.Error.Error())
+		return false
+	}
+	notification.Status = NotificationSending
+	notification.UpdatedAt = now
+	return claim.RowsAffected == 1
+}
+
+// deliverNotification sends one notification and stores the outcome.
+func deliverNotification(notification Notification) error {
+	now := time.Now()
+	update := map[string]interface{}{
+		"attempts":   notification.Attempts + 1,
+		"updated_at": now,
+	}
+
+	var errSending error
+	notifier, ok := services.GetNotifier(notification.Channel)
+	if !ok {
+		errSending = errors.New("kanal notifikasi " + notification.Channel + " tidak dikenal")
+	} else {
+		errSending = notifier.Send(notification.Recipient, notification.Subject, notification.Body)
+	}
+
+	if errSending == nil {
+		update["status"] = NotificationSent
+		update["sent_at"] = now
+		update["last_error"] = ""
+	} else {
+		update["last_error"] = errSending.Error()
+		if notification.Attempts+1 >= notificationMaxAttempts {
+			update["status"] = NotificationDead
+		} else {
+			update["status"] = NotificationPending
+			update["next_attempt_at"] = now.Add(notificationBackoff(notification.Attempts + 1))
+		}
+	}
+	if err := services.DB.Model(&notification).Updates(update).Error; err != nil {
+		return err
+	}
+	return errSending
+}
+
+// DispatchNotifications sends the notifications which are due, and reports
+// how many it tried.
+func DispatchNotifications() (int, error) {
+	now := time.Now()
+	var notifications []Notification
+	err := services.DB.
+		Where("status = ? AND next_attempt_at <= ?", NotificationPending, now).
+		Or("status = ? AND updated_at <= ?", NotificationSending, now.Add(-notificationSendingTimeout)).
+		Order("next_attempt_at").
+		Limit(notificationBatchSize).
+		Find(&notifications).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var tried = 0
+	for i := range notifications {
+		if !claimNotification(&notifications[i], now) {
+			continue
+		}
+		tried += 1
+		if err := deliverNotification(notifications[i]); err != nil {
+			log.Print("Failed to send notification #", notifications[i].ID, ": ", err.Error())
+		}
+	}
+	return tried, nil
+}
+
+// StartNotificationWorker sends the due notifications every interval until the
+// process stops.
+func StartNotificationWorker(interval time.Duration) {
+	go func() {
+		for {
+			if _, err := DispatchNotifications(); err != nil {
+				log.Print("Failed to dispatch notifications: ", err.Error())
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// RetryNotification puts a dead or pending notification back to be sent right
+// away, with a fresh count of attempts.
+func RetryNotification(tx *gorm.DB, notificationId uint64) (Notification, error) {
+	var notification Notification
+	if err := tx.First(&notification, notificationId).Error; err != nil {
+		return notification, err
+	}
+	if notification.Status == NotificationSent || notification.Status == NotificationSending {
+		return notification, errors.New("notifikasi berstatus " + notification.Status + " tidak dapat dikirim ulang")
+	}
+
+	now := time.Now()
+	update := map[string]interface{}{
+		"status":          NotificationPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	}
+	if err := tx.Model(&notification).Updates(update).Error; err != nil {
+		return notification, err
+	}
+	return notification, nil
+}
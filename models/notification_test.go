@@ -0,0 +1,15 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, notificationBackoff(1))
+	assert.Equal(t, time.Minute, notificationBackoff(2))
+	assert.Equal(t, 4*time.Minute, notificationBackoff(4))
+	assert.Equal(t, time.Hour, notificationBackoff(8))
+}
@@ -3,7 +3,8 @@ package models
 import (
 	"time"
 
-	"github.com/adeindriawan/itsfood-administration/services"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Order struct {
@@ -24,69 +25,141 @@ type Order struct {
 	BilledToCustomerAt time.Time     `gorm:"billed_to_customer_at" json:"billed_to_customer_at"`
 	PaidByCustomerAt   time.Time     `gorm:"paid_by_customer_at" json:"paid_by_customer_at"`
 	Info               string        `gorm:"info;not null" json:"info"`
-	Status             string        `gorm:"column:status;not null" json:"status"`
+	Status             OrderStatus   `gorm:"column:status;not null" json:"status"`
 	CreatedAt          time.Time     `gorm:"column:created_at;not null" json:"created_at"`
 	UpdatedAt          time.Time     `gorm:"column:updated_at;not null" json:"updated_at"`
 	CreatedBy          string        `gorm:"created_by;not null" json:"created_by"`
 }
 
 type OrderDump struct {
-	ID                 uint64    `gorm:"primaryKey" json:"id"`
-	SourceID           uint64    `gorm:"column:source_id;not null" json:"source_id"`
-	Order              Order     `gorm:"foreignKey:SourceID" json:"order"`
-	OrderedBy          uint64    `gorm:"column:ordered_by;not null" json:"ordered_by"`
-	Customer           Customer  `gorm:"foreignKey:OrderedBy" json:"customer"`
-	OrderedFor         time.Time `gorm:"column:ordered_for;not null" json:"ordered_for"`
-	OrderedTo          string    `gorm:"column:ordered_to;not null" json:"ordered_to"`
-	NumOfMenus         uint      `gorm:"column:num_of_menus;not null" json:"num_of_menus"`
-	QtyOfMenus         uint      `gorm:"column:qty_of_menus;not null" json:"qty_of_menus"`
-	Amount             uint64    `gorm:"column:amount;not null" json:"amount"`
-	Purpose            string    `gorm:"column:purpose;not null" json:"purpose"`
-	Activity           string    `gorm:"column:activity;not null" json:"activity"`
-	SourceOfFund       string    `gorm:"column:source_of_fund;not null" json:"source_of_fund"`
-	PaymentOption      string    `gorm:"column:payment_option;not null" json:"payment_option"`
-	BilledByVendorAt   time.Time `gorm:"billed_by_vendor_at" json:"billed_by_vendor_at"`
-	BilledToCustomerAt time.Time `gorm:"billed_to_customer_at" json:"billed_to_customer_at"`
-	PaidByCustomerAt   time.Time `gorm:"paid_by_customer_at" json:"paid_by_customer_at"`
-	Info               string    `gorm:"info;not null" json:"info"`
-	Status             string    `gorm:"column:status;not null" json:"status"`
-	CreatedAt          time.Time `gorm:"column:created_at;not null" json:"created_at"`
-	UpdatedAt          time.Time `gorm:"column:updated_at;not null" json:"updated_at"`
-	CreatedBy          string    `gorm:"created_by;not null" json:"created_by"`
+	ID                 uint64      `gorm:"primaryKey" json:"id"`
+	SourceID           uint64      `gorm:"column:source_id;not null" json:"source_id"`
+	Order              Order       `gorm:"foreignKey:SourceID" json:"order"`
+	OrderedBy          uint64      `gorm:"column:ordered_by;not null" json:"ordered_by"`
+	Customer           Customer    `gorm:"foreignKey:OrderedBy" json:"customer"`
+	OrderedFor         time.Time   `gorm:"column:ordered_for;not null" json:"ordered_for"`
+	OrderedTo          string      `gorm:"column:ordered_to;not null" json:"ordered_to"`
+	NumOfMenus         uint        `gorm:"column:num_of_menus;not null" json:"num_of_menus"`
+	QtyOfMenus         uint        `gorm:"column:qty_of_menus;not null" json:"qty_of_menus"`
+	Amount             uint64      `gorm:"column:amount;not null" json:"amount"`
+	Purpose            string      `gorm:"column:purpose;not null" json:"purpose"`
+	Activity           string      `gorm:"column:activity;not null" json:"activity"`
+	SourceOfFund       string      `gorm:"column:source_of_fund;not null" json:"source_of_fund"`
+	PaymentOption      string      `gorm:"column:payment_option;not null" json:"payment_option"`
+	BilledByVendorAt   time.Time   `gorm:"billed_by_vendor_at" json:"billed_by_vendor_at"`
+	BilledToCustomerAt time.Time   `gorm:"billed_to_customer_at" json:"billed_to_customer_at"`
+	PaidByCustomerAt   time.Time   `gorm:"paid_by_customer_at" json:"paid_by_customer_at"`
+	Info               string      `gorm:"info;not null" json:"info"`
+	Status             OrderStatus `gorm:"column:status;not null" json:"status"`
+	CreatedAt          time.Time   `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt          time.Time   `gorm:"column:updated_at;not null" json:"updated_at"`
+	CreatedBy          string      `gorm:"created_by;not null" json:"created_by"`
 }
 
 func (OrderDump) TableName() string {
 	return "__orders"
 }
 
-func UpdateOrder(params map[string]interface{}, update map[string]interface{}) {
-	var orders []Order
-	services.DB.Find(&orders, params)
-	// create dump
-	for _, item := range orders {
-		orderDump := OrderDump{
-			SourceID:           item.ID,
-			OrderedBy:          item.OrderedBy,
-			OrderedFor:         item.OrderedFor,
-			OrderedTo:          item.OrderedTo,
-			NumOfMenus:         item.NumOfMenus,
-			QtyOfMenus:         item.QtyOfMenus,
-			Amount:             item.Amount,
-			Purpose:            item.Purpose,
-			Activity:           item.Activity,
-			SourceOfFund:       item.SourceOfFund,
-			PaymentOption:      item.PaymentOption,
-			BilledByVendorAt:   item.BilledByVendorAt,
-			BilledToCustomerAt: item.BilledToCustomerAt,
-			PaidByCustomerAt:   item.PaidByCustomerAt,
-			Info:               item.Info,
-			Status:             item.Status,
-			CreatedAt:          item.CreatedAt,
-			UpdatedAt:          item.UpdatedAt,
-			CreatedBy:          item.CreatedBy,
+func newOrderDump(item Order) OrderDump {
+	return OrderDump{
+		SourceID:           item.ID,
+		OrderedBy:          item.OrderedBy,
+		OrderedFor:         item.OrderedFor,
+		OrderedTo:          item.OrderedTo,
+		NumOfMenus:         item.NumOfMenus,
+		QtyOfMenus:         item.QtyOfMenus,
+		Amount:             item.Amount,
+		Purpose:            item.Purpose,
+		Activity:           item.Activity,
+		SourceOfFund:       item.SourceOfFund,
+		PaymentOption:      item.PaymentOption,
+		BilledByVendorAt:   item.BilledByVendorAt,
+		BilledToCustomerAt: item.BilledToCustomerAt,
+		PaidByCustomerAt:   item.PaidByCustomerAt,
+		Info:               item.Info,
+		Status:             item.Status,
+		CreatedAt:          item.CreatedAt,
+		UpdatedAt:          item.UpdatedAt,
+		CreatedBy:          item.CreatedBy,
+	}
+}
+
+// UpdateOrder dumps the current version of the matching orders and then applies
+// update to them. Both happen in one transaction on tx, which may itself be a
+// transaction started by the caller to chain several updates.
+func UpdateOrder(tx *gorm.DB, params map[string]interface{}, update map[string]interface{}) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var orders []Order
+		if err := tx.Find(&orders, params).Error; err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		// create dump
+		for _, item := range orders {
+			orderDump := newOrderDump(item)
+			if err := tx.Omit(clause.Associations).Create(&orderDump).Error; err != nil {
+				return err
+			}
+		}
+		// update record
+		return tx.Model(&orders).Updates(update).Error
+	})
+}
+
+// RecountOrder reprices an order with CalculateOrderPricing, recomputes its
+// num_of_menus and qty_of_menus from the details which are not cancelled, and
+// derives its status from theirs. It is the only place an order status is
+// written after a detail changes, so an order without any detail left is
+// cancelled the same way everywhere.
+func RecountOrder(tx *gorm.DB, orderId uint64, createdBy string) (Order, error) {
+	var order Order
+	if err := tx.First(&order, orderId).Error; err != nil {
+		return order, err
+	}
+
+	pricing, orderDetails, err := PriceOrder(tx, orderId)
+	if err != nil {
+		return order, err
+	}
+
+	var newQtyOfMenus uint
+	var newNumOfMenus uint
+	for _, i := range orderDetails {
+		if i.Status != OrderDetailCancelled {
+			newQtyOfMenus += i.Qty
+			newNumOfMenus += 1
 		}
-		services.DB.Create(&orderDump)
 	}
-	// update record
-	services.DB.Model(&orders).Updates(update)
+
+	newStatus := DeriveOrderStatus(orderDetails)
+	if newStatus != order.Status && !order.Status.CanTransitionTo(newStatus) {
+		return order, TransitionError{Entity: "order", From: string(order.Status), To: string(newStatus)}
+	}
+
+	updatedOrder := map[string]interface{}{
+		"amount":       pricing.Amount(),
+		"num_of_menus": newNumOfMenus,
+		"qty_of_menus": newQtyOfMenus,
+		"updated_at":   time.Now(),
+		"created_by":   createdBy,
+	}
+	if newStatus != order.Status {
+		updatedOrder["status"] = newStatus
+	}
+	if err := UpdateOrder(tx, map[string]interface{}{"id": orderId}, updatedOrder); err != nil {
+		return order, err
+	}
+	if err := SaveOrderPricing(tx, pricing, createdBy); err != nil {
+		return order, err
+	}
+
+	order.Amount = pricing.Amount()
+	order.NumOfMenus = newNumOfMenus
+	order.QtyOfMenus = newQtyOfMenus
+	order.Status = newStatus
+
+	return order, nil
 }
@@ -3,71 +3,147 @@ package models
 import (
 	"time"
 
-	"github.com/adeindriawan/itsfood-administration/services"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderDetail struct {
-	ID                    uint64     `gorm:"primaryKey" json:"id"`
-	OrderID               uint64     `gorm:"column:order_id;not null" json:"order_id"`
-	Order                 Order      `json:"order"`
-	MenuID                uint64     `gorm:"column:menu_id;not null" json:"menu_id"`
-	Menu                  Menu       `json:"menu"`
-	Qty                   uint       `gorm:"column:qty;not null" json:"qty"`
-	Price                 uint64     `gorm:"column:price;not null" json:"price"`
-	COGS                  uint64     `gorm:"column:cogs;not null" json:"cogs"`
-	Note                  string     `gorm:"column:note" json:"note"`
-	ReasonForCancellation string     `gorm:"column:reason_for_cancellation" json:"reason_for_cancellation"`
-	Status                string     `gorm:"column:status;not null" json:"status"`
-	Discounts             []Discount `json:"discounts"`
-	Costs                 []Cost     `json:"costs"`
-	CreatedAt             time.Time  `gorm:"column:created_at;not null" json:"created_at"`
-	UpdatedAt             time.Time  `gorm:"column:updated_at" json:"updated_at"`
-	CreatedBy             string     `gorm:"column:created_by;not null" json:"created_by"`
+	ID                    uint64            `gorm:"primaryKey" json:"id"`
+	OrderID               uint64            `gorm:"column:order_id;not null" json:"order_id"`
+	Order                 Order             `json:"order"`
+	MenuID                uint64            `gorm:"column:menu_id;not null" json:"menu_id"`
+	Menu                  Menu              `json:"menu"`
+	Qty                   uint              `gorm:"column:qty;not null" json:"qty"`
+	Price                 uint64            `gorm:"column:price;not null" json:"price"`
+	COGS                  uint64            `gorm:"column:cogs;not null" json:"cogs"`
+	Note                  string            `gorm:"column:note" json:"note"`
+	ReasonForCancellation string            `gorm:"column:reason_for_cancellation" json:"reason_for_cancellation"`
+	Status                OrderDetailStatus `gorm:"column:status;not null" json:"status"`
+	Discounts             []Discount        `json:"discounts"`
+	Costs                 []Cost            `json:"costs"`
+	CreatedAt             time.Time         `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt             time.Time         `gorm:"column:updated_at" json:"updated_at"`
+	CreatedBy             string            `gorm:"column:created_by;not null" json:"created_by"`
 }
 
 type OrderDetailDump struct {
-	ID                    uint64      `gorm:"primaryKey" json:"id"`
-	SourceID              uint64      `gorm:"column:source_id;not null" json:"source_id"`
-	OrderDetail           OrderDetail `gorm:"foreignKey:SourceID" json:"order_detail"`
-	OrderID               uint64      `gorm:"column:order_id;not null" json:"order_id"`
-	Order                 Order       `json:"order"`
-	MenuID                uint64      `gorm:"column:menu_id;not null" json:"menu_id"`
-	Menu                  Menu        `json:"menu"`
-	Qty                   uint        `gorm:"column:qty;not null" json:"qty"`
-	Price                 uint64      `gorm:"column:price;not null" json:"price"`
-	COGS                  uint64      `gorm:"column:cogs;not null" json:"cogs"`
-	Note                  string      `gorm:"column:note" json:"note"`
-	ReasonForCancellation string      `gorm:"column:reason_for_cancellation" json:"reason_for_cancellation"`
-	Status                string      `gorm:"column:status;not null" json:"status"`
-	CreatedAt             time.Time   `gorm:"column:created_at;not null" json:"created_at"`
-	UpdatedAt             time.Time   `gorm:"column:updated_at" json:"updated_at"`
-	CreatedBy             string      `gorm:"column:created_by;not null" json:"created_by"`
+	ID                    uint64            `gorm:"primaryKey" json:"id"`
+	SourceID              uint64            `gorm:"column:source_id;not null" json:"source_id"`
+	OrderDetail           OrderDetail       `gorm:"foreignKey:SourceID" json:"order_detail"`
+	OrderID               uint64            `gorm:"column:order_id;not null" json:"order_id"`
+	Order                 Order             `json:"order"`
+	MenuID                uint64            `gorm:"column:menu_id;not null" json:"menu_id"`
+	Menu                  Menu              `json:"menu"`
+	Qty                   uint              `gorm:"column:qty;not null" json:"qty"`
+	Price                 uint64            `gorm:"column:price;not null" json:"price"`
+	COGS                  uint64            `gorm:"column:cogs;not null" json:"cogs"`
+	Note                  string            `gorm:"column:note" json:"note"`
+	ReasonForCancellation string            `gorm:"column:reason_for_cancellation" json:"reason_for_cancellation"`
+	Status                OrderDetailStatus `gorm:"column:status;not null" json:"status"`
+	CreatedAt             time.Time         `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt             time.Time         `gorm:"column:updated_at" json:"updated_at"`
+	CreatedBy             string            `gorm:"column:created_by;not null" json:"created_by"`
 }
 
 func (OrderDetailDump) TableName() string {
 	return "__order_details"
 }
 
-func UpdateOrderDetail(params map[string]interface{}, update map[string]interface{}) {
+// UpdateOrderDetail dumps the current version of the matching order details and
+// then applies update to them. Both happen in one transaction on tx, which may
+// itself be a transaction started by the caller to chain several updates.
+func UpdateOrderDetail(tx *gorm.DB, params map[string]interface{}, update map[string]interface{}) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var orderDetails []OrderDetail
+		if err := tx.Find(&orderDetails, params).Error; err != nil {
+			return err
+		}
+		if len(orderDetails) == 0 {
+			return nil
+		}
+
+		for _, item := range orderDetails {
+			if err := dumpOrderDetail(tx, item); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&orderDetails).Updates(update).Error
+	})
+}
+
+// TransitionOrderDetail moves the matching order details to the next status,
+// together with the rest of update. Nothing is written unless every one of them
+// is allowed to make the move.
+func TransitionOrderDetail(tx *gorm.DB, params map[string]interface{}, next OrderDetailStatus, update map[string]interface{}) error {
 	var orderDetails []OrderDetail
-	services.DB.Find(&orderDetails, params)
+	if err := tx.Find(&orderDetails, params).Error; err != nil {
+		return err
+	}
 
 	for _, item := range orderDetails {
-		orderDetailDump := OrderDetailDump{
-			SourceID:              item.ID,
-			OrderID:               item.OrderID,
-			MenuID:                item.MenuID,
-			Qty:                   item.Qty,
-			Price:                 item.Price,
-			COGS:                  item.COGS,
-			Note:                  item.Note,
-			ReasonForCancellation: item.ReasonForCancellation,
-			Status:                item.Status,
-			CreatedAt:             item.CreatedAt,
-			UpdatedAt:             item.UpdatedAt,
-			CreatedBy:             item.CreatedBy,
+		if !item.Status.CanTransitionTo(next) {
+			return TransitionError{Entity: "detail order", From: string(item.Status), To: string(next)}
 		}
-		services.DB.Create(&orderDetailDump)
 	}
-	services.DB.Model(&orderDetails).Updates(update)
+
+	update["status"] = next
+	return UpdateOrderDetail(tx, params, update)
+}
+
+func newOrderDetailDump(item OrderDetail) OrderDetailDump {
+	return OrderDetailDump{
+		SourceID:              item.ID,
+		OrderID:               item.OrderID,
+		MenuID:                item.MenuID,
+		Qty:                   item.Qty,
+		Price:                 item.Price,
+		COGS:                  item.COGS,
+		Note:                  item.Note,
+		ReasonForCancellation: item.ReasonForCancellation,
+		Status:                item.Status,
+		CreatedAt:             item.CreatedAt,
+		UpdatedAt:             item.UpdatedAt,
+		CreatedBy:             item.CreatedBy,
+	}
+}
+
+func dumpOrderDetail(tx *gorm.DB, item OrderDetail) error {
+	orderDetailDump := newOrderDetailDump(item)
+	return tx.Omit(clause.Associations).Create(&orderDetailDump).Error
+}
+
+// CreateOrderDetail inserts a new order detail and dumps its first version so
+// the line shows up in the history of the order from the moment it was added.
+func CreateOrderDetail(tx *gorm.DB, orderDetail *OrderDetail) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(orderDetail).Error; err != nil {
+			return err
+		}
+		return dumpOrderDetail(tx, *orderDetail)
+	})
+}
+
+// DeleteOrderDetail stamps the matching order details with who deleted them
+// and when, dumps that last version, and then removes them.
+func DeleteOrderDetail(tx *gorm.DB, params map[string]interface{}, deletedBy string) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := UpdateOrderDetail(tx, params, map[string]interface{}{"updated_at": time.Now(), "created_by": deletedBy}); err != nil {
+			return err
+		}
+
+		var orderDetails []OrderDetail
+		if err := tx.Find(&orderDetails, params).Error; err != nil {
+			return err
+		}
+		if len(orderDetails) == 0 {
+			return nil
+		}
+
+		for _, item := range orderDetails {
+			if err := dumpOrderDetail(tx, item); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&orderDetails).Error
+	})
 }
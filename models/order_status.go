@@ -0,0 +1,180 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"golang.org/x/exp/slices"
+)
+
+type OrderStatus string
+
+const (
+	OrderCreated            OrderStatus = "Created"
+	OrderForwardedPartially OrderStatus = "ForwardedPartially"
+	OrderForwardedEntirely  OrderStatus = "ForwardedEntirely"
+	OrderDelivered          OrderStatus = "Delivered"
+	OrderCancelled          OrderStatus = "Cancelled"
+)
+
+func (status *OrderStatus) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		*status = OrderStatus(v)
+	case string:
+		*status = OrderStatus(v)
+	}
+	return nil
+}
+
+func (status OrderStatus) Value() (driver.Value, error) {
+	return string(status), nil
+}
+
+type OrderDetailStatus string
+
+const (
+	OrderDetailCreated   OrderDetailStatus = "Created"
+	OrderDetailSent      OrderDetailStatus = "Sent"
+	OrderDetailAccepted  OrderDetailStatus = "Accepted"
+	OrderDetailReady     OrderDetailStatus = "Ready"
+	OrderDetailDelivered OrderDetailStatus = "Delivered"
+	OrderDetailCancelled OrderDetailStatus = "Cancelled"
+)
+
+func (status *OrderDetailStatus) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		*status = OrderDetailStatus(v)
+	case string:
+		*status = OrderDetailStatus(v)
+	}
+	return nil
+}
+
+func (status OrderDetailStatus) Value() (driver.Value, error) {
+	return string(status), nil
+}
+
+// orderTransitions lists, for every order status, the statuses it may move to.
+// Created and both Forwarded statuses move freely among each other because they
+// are derived from the details, which can be added, sent or cancelled at any time.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderCreated:            {OrderForwardedPartially, OrderForwardedEntirely, OrderDelivered, OrderCancelled},
+	OrderForwardedPartially: {OrderCreated, OrderForwardedEntirely, OrderDelivered, OrderCancelled},
+	OrderForwardedEntirely:  {OrderCreated, OrderForwardedPartially, OrderDelivered, OrderCancelled},
+	OrderDelivered:          {},
+	OrderCancelled:          {},
+}
+
+// A detail sent to a vendor may be accepted and then marked ready by the
+// vendor, but it can skip straight to Delivered as well.
+var orderDetailTransitions = map[OrderDetailStatus][]OrderDetailStatus{
+	OrderDetailCreated:   {OrderDetailSent, OrderDetailCancelled},
+	OrderDetailSent:      {OrderDetailAccepted, OrderDetailReady, OrderDetailDelivered, OrderDetailCancelled},
+	OrderDetailAccepted:  {OrderDetailReady, OrderDetailDelivered, OrderDetailCancelled},
+	OrderDetailReady:     {OrderDetailDelivered, OrderDetailCancelled},
+	OrderDetailDelivered: {},
+	OrderDetailCancelled: {},
+}
+
+type TransitionError struct {
+	Entity string
+	From   string
+	To     string
+}
+
+func (e TransitionError) Error() string {
+	return fmt.Sprintf("status %s tidak dapat diubah dari %s menjadi %s", e.Entity, e.From, e.To)
+}
+
+func (status OrderStatus) IsValid() bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// IsFinal reports whether an order can no longer be changed at all.
+func (status OrderStatus) IsFinal() bool {
+	allowed, ok := orderTransitions[status]
+	return ok && len(allowed) == 0
+}
+
+// CanTransitionTo reports whether an order may move to the next status. Staying
+// on the same status is not a move, so it is false like for order details.
+// Orders still carrying a status from before the transition table existed are
+// let through so they can be brought back into it.
+func (status OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	if status == next {
+		return false
+	}
+	allowed, ok := orderTransitions[status]
+	if !ok {
+		return true
+	}
+	return slices.Contains(allowed, next)
+}
+
+func (status OrderDetailStatus) IsValid() bool {
+	_, ok := orderDetailTransitions[status]
+	return ok
+}
+
+// IsFinal reports whether an order detail can no longer be changed at all.
+func (status OrderDetailStatus) IsFinal() bool {
+	allowed, ok := orderDetailTransitions[status]
+	return ok && len(allowed) == 0
+}
+
+// IsWithVendor reports whether an order detail was sent to its vendor and is
+// not delivered or cancelled yet.
+func (status OrderDetailStatus) IsWithVendor() bool {
+	return status == OrderDetailSent || status == OrderDetailAccepted || status == OrderDetailReady
+}
+
+// IsNewDetailStatus reports whether a newly created order detail could have
+// status, either right away or after one move.
+func (status OrderDetailStatus) IsNewDetailStatus() bool {
+	return status == OrderDetailCreated || OrderDetailCreated.CanTransitionTo(status)
+}
+
+func (status OrderDetailStatus) CanTransitionTo(next OrderDetailStatus) bool {
+	if status == next {
+		return false
+	}
+	allowed, ok := orderDetailTransitions[status]
+	if !ok {
+		return next.IsValid()
+	}
+	return slices.Contains(allowed, next)
+}
+
+// DeriveOrderStatus computes the status an order should have from the statuses
+// of its details.
+func DeriveOrderStatus(orderDetails []OrderDetail) OrderStatus {
+	var active, forwarded, delivered int
+	for _, item := range orderDetails {
+		switch item.Status {
+		case OrderDetailCancelled:
+			continue
+		case OrderDetailSent, OrderDetailAccepted, OrderDetailReady:
+			forwarded++
+		case OrderDetailDelivered:
+			forwarded++
+			delivered++
+		}
+		active++
+	}
+
+	switch {
+	case active == 0:
+		return OrderCancelled
+	case delivered == active:
+		return OrderDelivered
+	case forwarded == active:
+		return OrderForwardedEntirely
+	case forwarded > 0:
+		return OrderForwardedPartially
+	default:
+		return OrderCreated
+	}
+}
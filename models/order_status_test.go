@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderDetailTransitions(t *testing.T) {
+	assert.True(t, OrderDetailCreated.CanTransitionTo(OrderDetailSent))
+	assert.True(t, OrderDetailSent.CanTransitionTo(OrderDetailDelivered))
+	assert.False(t, OrderDetailCancelled.CanTransitionTo(OrderDetailCreated))
+	assert.False(t, OrderDetailDelivered.CanTransitionTo(OrderDetailSent))
+	assert.False(t, OrderDetailSent.CanTransitionTo(OrderDetailSent))
+	assert.True(t, OrderDetailSent.CanTransitionTo(OrderDetailAccepted))
+	assert.True(t, OrderDetailAccepted.CanTransitionTo(OrderDetailReady))
+	assert.True(t, OrderDetailReady.CanTransitionTo(OrderDetailDelivered))
+	assert.False(t, OrderDetailReady.CanTransitionTo(OrderDetailAccepted))
+	assert.False(t, OrderDetailCreated.CanTransitionTo(OrderDetailReady))
+}
+
+func TestIsNewDetailStatus(t *testing.T) {
+	assert.True(t, OrderDetailCreated.IsNewDetailStatus())
+	assert.True(t, OrderDetailSent.IsNewDetailStatus())
+	assert.True(t, OrderDetailCancelled.IsNewDetailStatus())
+	assert.False(t, OrderDetailAccepted.IsNewDetailStatus())
+	assert.False(t, OrderDetailDelivered.IsNewDetailStatus())
+}
+
+func TestOrderTransitions(t *testing.T) {
+	assert.True(t, OrderCreated.CanTransitionTo(OrderForwardedPartially))
+	assert.True(t, OrderForwardedEntirely.CanTransitionTo(OrderCreated))
+	assert.False(t, OrderCancelled.CanTransitionTo(OrderCreated))
+	assert.False(t, OrderDelivered.CanTransitionTo(OrderForwardedEntirely))
+	assert.False(t, OrderCreated.CanTransitionTo(OrderCreated))
+}
+
+func TestDeriveOrderStatus(t *testing.T) {
+	detail := func(status OrderDetailStatus) OrderDetail {
+		return OrderDetail{Status: status}
+	}
+
+	assert.Equal(t, OrderCreated, DeriveOrderStatus([]OrderDetail{detail(OrderDetailCreated), detail(OrderDetailCancelled)}))
+	assert.Equal(t, OrderForwardedPartially, DeriveOrderStatus([]OrderDetail{detail(OrderDetailCreated), detail(OrderDetailSent)}))
+	assert.Equal(t, OrderForwardedEntirely, DeriveOrderStatus([]OrderDetail{detail(OrderDetailSent), detail(OrderDetailDelivered), detail(OrderDetailCancelled)}))
+	assert.Equal(t, OrderForwardedEntirely, DeriveOrderStatus([]OrderDetail{detail(OrderDetailAccepted), detail(OrderDetailReady)}))
+	assert.Equal(t, OrderDelivered, DeriveOrderStatus([]OrderDetail{detail(OrderDetailDelivered)}))
+	assert.Equal(t, OrderCancelled, DeriveOrderStatus([]OrderDetail{detail(OrderDetailCancelled)}))
+	assert.Equal(t, OrderCancelled, DeriveOrderStatus(nil))
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrderPricing is the breakdown of what an order is worth to the customer and
+// what it costs at the vendors. Costs are always charged to the customer, and
+// the ones issued by a vendor are also paid to that vendor. Discounts issued by
+// a vendor lower the purchase, the rest lower the sales. Cancelled details are
+// left out. NetSales is what gets stored as the amount of the order.
+type OrderPricing struct {
+	OrderID           uint64    `gorm:"primaryKey;autoIncrement:false;column:order_id" json:"order_id"`
+	GrossSales        uint64    `gorm:"column:gross_sales;not null" json:"gross_sales"`
+	GrossPurchase     uint64    `gorm:"column:gross_purchase;not null" json:"gross_purchase"`
+	CustomerCosts     uint64    `gorm:"column:customer_costs;not null" json:"customer_costs"`
+	VendorCosts       uint64    `gorm:"column:vendor_costs;not null" json:"vendor_costs"`
+	CustomerDiscounts uint64    `gorm:"column:customer_discounts;not null" json:"customer_discounts"`
+	VendorDiscounts   uint64    `gorm:"column:vendor_discounts;not null" json:"vendor_discounts"`
+	NetSales          int64     `gorm:"column:net_sales;not null" json:"net_sales"`
+	NetPurchase       int64     `gorm:"column:net_purchase;not null" json:"net_purchase"`
+	UpdatedAt         time.Time `gorm:"column:updated_at;autoUpdateTime:false" json:"updated_at"`
+	UpdatedBy         string    `gorm:"column:updated_by;not null" json:"updated_by"`
+}
+
+func (OrderPricing) TableName() string {
+	return "order_pricings"
+}
+
+// Amount is the value stored in orders.amount, which cannot go below zero.
+func (pricing OrderPricing) Amount() uint64 {
+	if pricing.NetSales < 0 {
+		return 0
+	}
+	return uint64(pricing.NetSales)
+}
+
+// CalculateOrderPricing prices the given details of an order. Their costs and
+// discounts have to be loaded already.
+func CalculateOrderPricing(orderDetails []OrderDetail) OrderPricing {
+	var pricing OrderPricing
+	for _, od := range orderDetails {
+		if od.Status == OrderDetailCancelled {
+			continue
+		}
+		pricing.GrossSales += od.Price * uint64(od.Qty)
+		pricing.GrossPurchase += od.COGS * uint64(od.Qty)
+
+		for _, cost := range od.Costs {
+			if cost.Issuer == "Vendor" {
+				pricing.VendorCosts += uint64(cost.Amount)
+			} else {
+				pricing.CustomerCosts += uint64(cost.Amount)
+			}
+		}
+
+		for _, discount := range od.Discounts {
+			if discount.Issuer == "Vendor" {
+				pricing.VendorDiscounts += uint64(discount.Amount)
+			} else {
+				pricing.CustomerDiscounts += uint64(discount.Amount)
+			}
+		}
+	}
+
+	pricing.NetSales = int64(pricing.GrossSales+pricing.CustomerCosts+pricing.VendorCosts) - int64(pricing.CustomerDiscounts)
+	pricing.NetPurchase = int64(pricing.GrossPurchase+pricing.VendorCosts) - int64(pricing.VendorDiscounts)
+
+	return pricing
+}
+
+// PriceOrder loads every detail of an order with its costs and discounts and
+// prices them.
+func PriceOrder(tx *gorm.DB, orderId uint64) (OrderPricing, []OrderDetail, error) {
+	var orderDetails []OrderDetail
+	if err := tx.Preload("Costs").Preload("Discounts").Where("order_id", orderId).Find(&orderDetails).Error; err != nil {
+		return OrderPricing{}, nil, err
+	}
+
+	pricing := CalculateOrderPricing(orderDetails)
+	pricing.OrderID = orderId
+	return pricing, orderDetails, nil
+}
+
+// SaveOrderPricing stores the latest breakdown of an order, replacing the one
+// stored before.
+func SaveOrderPricing(tx *gorm.DB, pricing OrderPricing, updatedBy string) error {
+	pricing.UpdatedAt = time.Now()
+	pricing.UpdatedBy = updatedBy
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&pricing).Error
+}
+
+type OrderTotalsRepair struct {
+	OrderID   uint64       `json:"order_id"`
+	OldAmount uint64       `json:"old_amount"`
+	NewAmount uint64       `json:"new_amount"`
+	Pricing   OrderPricing `json:"pricing"`
+}
+
+// RepairOrderTotals reprices an order and, when the stored amount, num_of_menus
+// or qty_of_menus do not match, fixes them. The status is left as it is. It
+// reports whether anything had to be repaired.
+func RepairOrderTotals(tx *gorm.DB, orderId uint64, repairedBy string, dryRun bool) (OrderTotalsRepair, bool, error) {
+	repair := OrderTotalsRepair{OrderID: orderId}
+
+	var order Order
+	if err := tx.First(&order, orderId).Error; err != nil {
+		return repair, false, err
+	}
+	pricing, orderDetails, err := PriceOrder(tx, orderId)
+	if err != nil {
+		return repair, false, err
+	}
+
+	var numOfMenus, qtyOfMenus uint
+	for _, i := range orderDetails {
+		if i.Status != OrderDetailCancelled {
+			numOfMenus += 1
+			qtyOfMenus += i.Qty
+		}
+	}
+
+	repair.OldAmount = order.Amount
+	repair.NewAmount = pricing.Amount()
+	repair.Pricing = pricing
+
+	var storedPricing OrderPricing
+	storedPricingQuery := tx.Where("order_id = ?", orderId).Limit(1).Find(&storedPricing)
+	if storedPricingQuery.Error != nil {
+		return repair, false, storedPricingQuery.Error
+	}
+	pricingChanged := storedPricingQuery.RowsAffected == 0 ||
+		storedPricing.NetSales != pricing.NetSales || storedPricing.NetPurchase != pricing.NetPurchase ||
+		storedPricing.GrossSales != pricing.GrossSales || storedPricing.GrossPurchase != pricing.GrossPurchase ||
+		storedPricing.CustomerCosts != pricing.CustomerCosts || storedPricing.VendorCosts != pricing.VendorCosts ||
+		storedPricing.CustomerDiscounts != pricing.CustomerDiscounts || storedPricing.VendorDiscounts != pricing.VendorDiscounts
+	totalsChanged := order.Amount != pricing.Amount() || order.NumOfMenus != numOfMenus || order.QtyOfMenus != qtyOfMenus
+
+	if !pricingChanged && !totalsChanged {
+		return repair, false, nil
+	}
+	if dryRun {
+		return repair, true, nil
+	}
+
+	if totalsChanged {
+		err := UpdateOrder(tx, map[string]interface{}{"id": orderId}, map[string]interface{}{
+			"amount":       pricing.Amount(),
+			"num_of_menus": numOfMenus,
+			"qty_of_menus": qtyOfMenus,
+			"updated_at":   time.Now(),
+			"created_by":   repairedBy,
+		})
+		if err != nil {
+			return repair, false, err
+		}
+	}
+	if err := SaveOrderPricing(tx, pricing, repairedBy); err != nil {
+		return repair, false, err
+	}
+
+	return repair, true, nil
+}
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+// Permissions guard the admin endpoints, each route asking for one of them.
+const (
+	PermissionOrdersRead         = "orders.read"
+	PermissionOrdersWrite        = "orders.write"
+	PermissionCustomersRead      = "customers.read"
+	PermissionVendorsRead        = "vendors.read"
+	PermissionVendorsWrite       = "vendors.write"
+	PermissionVendorsSensitive   = "vendors.sensitive"
+	PermissionMenusRead          = "menus.read"
+	PermissionMenusWrite         = "menus.write"
+	PermissionPricingWrite       = "pricing.write"
+	PermissionPricingLarge       = "pricing.large"
+	PermissionNotificationsRead  = "notifications.read"
+	PermissionNotificationsWrite = "notifications.write"
+	PermissionTemplatesRead      = "templates.read"
+	PermissionTemplatesWrite     = "templates.write"
+	PermissionAdminsManage       = "admins.manage"
+	PermissionRolesManage        = "roles.manage"
+	PermissionSettingsManage     = "settings.manage"
+)
+
+const (
+	RoleViewer     = "viewer"
+	RoleOperator   = "operator"
+	RoleFinance    = "finance"
+	RoleSuperAdmin = "superadmin"
+)
+
+var permissionNames = []string{
+	PermissionOrdersRead, PermissionOrdersWrite, PermissionCustomersRead,
+	PermissionVendorsRead, PermissionVendorsWrite, PermissionVendorsSensitive,
+	PermissionMenusRead, PermissionMenusWrite, PermissionPricingWrite,
+	PermissionPricingLarge, PermissionNotificationsRead, PermissionNotificationsWrite,
+	PermissionTemplatesRead, PermissionTemplatesWrite, PermissionAdminsManage,
+	PermissionRolesManage, PermissionSettingsManage,
+}
+
+var readPermissions = []string{
+	PermissionOrdersRead,
+	PermissionCustomersRead,
+	PermissionVendorsRead,
+	PermissionMenusRead,
+	PermissionNotificationsRead,
+	PermissionTemplatesRead,
+}
+
+// defaultRoles are created on the first start. Their permissions can be
+// changed in the database afterwards, a later start leaves them alone.
+var defaultRoles = []struct {
+	Name        string
+	Description string
+	Permissions []string
+}{
+	{RoleViewer, "Hanya dapat melihat data", readPermissions},
+	{RoleOperator, "Mengelola order, vendor, menu dan notifikasi sehari-hari", append([]string{
+		PermissionOrdersWrite,
+		PermissionVendorsWrite,
+		PermissionMenusWrite,
+		PermissionPricingWrite,
+		PermissionNotificationsWrite,
+	}, readPermissions...)},
+	{RoleFinance, "Mengelola diskon dan biaya dalam jumlah besar serta data keuangan vendor", append([]string{
+		PermissionPricingWrite,
+		PermissionPricingLarge,
+		PermissionVendorsSensitive,
+	}, readPermissions...)},
+	{RoleSuperAdmin, "Mengelola semua hal termasuk admin lain", nil},
+}
+
+type Permission struct {
+	ID   uint64 `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"column:name;size:100;not null;uniqueIndex" json:"name"`
+}
+
+func (Permission) TableName() string {
+	return "permissions"
+}
+
+type Role struct {
+	ID          uint64       `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"column:name;size:100;not null;uniqueIndex" json:"name"`
+	Description string       `gorm:"column:description" json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+// AdminRole assigns a role to an admin.
+type AdminRole struct {
+	AdminID    uint64    `gorm:"primaryKey;autoIncrement:false" json:"admin_id"`
+	RoleID     uint64    `gorm:"primaryKey;autoIncrement:false" json:"role_id"`
+	Role       Role      `json:"role"`
+	AssignedBy string    `gorm:"column:assigned_by;not null" json:"assigned_by"`
+	CreatedAt  time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (AdminRole) TableName() string {
+	return "admin_roles"
+}
+
+// PermissionSet holds the names of the permissions of an admin.
+type PermissionSet map[string]bool
+
+// Has tells whether every one of permissions is in the set.
+func (set PermissionSet) Has(permissions ...string) bool {
+	for _, permission := range permissions {
+		if !set[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetAdminPermissions collects the permissions of all roles of an admin.
+func GetAdminPermissions(adminId uint64) (PermissionSet, error) {
+	var names []string
+	err := services.DB.Table("admin_roles").
+		Joins("JOIN role_permissions ON role_permissions.role_id = admin_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("admin_roles.admin_id = ?", adminId).
+		Distinct().
+		Pluck("permissions.name", &names).Error
+	var set = PermissionSet{}
+	for _, name := range names {
+		set[name] = true
+	}
+	return set, err
+}
+
+func GetAdminRoles(tx *gorm.DB, adminId uint64) ([]AdminRole, error) {
+	var adminRoles = []AdminRole{}
+	err := tx.Preload("Role").Where("admin_id = ?", adminId).Order("role_id").Find(&adminRoles).Error
+	return adminRoles, err
+}
+
+// AssignRole gives a role to an admin. Giving a role the admin already has
+// changes nothing.
+func AssignRole(tx *gorm.DB, adminId uint64, roleName string, by Admin) (AdminRole, error) {
+	var adminRole AdminRole
+	var admin Admin
+	if err := tx.First(&admin, adminId).Error; err != nil {
+		return adminRole, err
+	}
+	var role Role
+	if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return adminRole, err
+	}
+	adminRole = AdminRole{AdminID: admin.ID, RoleID: role.ID, Role: role, AssignedBy: by.User.Name, CreatedAt: time.Now()}
+	err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&adminRole).Error
+	return adminRole, err
+}
+
+// RemoveRole takes a role away from an admin. The last super admin cannot
+// lose the role, or nobody could manage the admins anymore.
+func RemoveRole(tx *gorm.DB, adminId uint64, roleName string) error {
+	var role Role
+	if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return err
+	}
+	if role.Name == RoleSuperAdmin {
+		var superAdmins int64
+		query := tx.Model(&AdminRole{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("role_id = ? AND admin_id <> ?", role.ID, adminId).
+			Count(&superAdmins)
+		if query.Error != nil {
+			return query.Error
+		}
+		if superAdmins == 0 {
+			return AdminAccountError{"harus ada minimal satu super admin"}
+		}
+	}
+	query := tx.Where("admin_id = ? AND role_id = ?", adminId, role.ID).Delete(&AdminRole{})
+	if query.Error != nil {
+		return query.Error
+	}
+	if query.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// isEmailListed tells whether email is in the ;-separated list of emails in
+// the environment variable envVar.
+func isEmailListed(envVar string, email string) bool {
+	for _, listed := range strings.Split(os.Getenv(envVar), ";") {
+		listed = strings.TrimSpace(listed)
+		if listed != "" && strings.EqualFold(listed, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// seedRoles creates the permissions and the default roles which are missing.
+// On the first start every active admin becomes an operator, so nobody loses
+// access. The admins in SUPER_ADMIN_EMAILS become super admins only while
+// nobody holds the role, so there is someone to hand out the roles, but a
+// super admin removed through /admins/:id/roles stays removed on restart.
+func seedRoles(tx *gorm.DB) error {
+	var allPermissions []Permission
+	for _, name := range permissionNames {
+		permission := Permission{Name: name}
+		if err := tx.Where(permission).FirstOrCreate(&permission).Error; err != nil {
+			return err
+		}
+		allPermissions = append(allPermissions, permission)
+	}
+	byName := map[string]Permission{}
+	for _, permission := range allPermissions {
+		byName[permission.Name] = permission
+	}
+
+	var existingRoles int64
+	if err := tx.Model(&Role{}).Count(&existingRoles).Error; err != nil {
+		return err
+	}
+	firstStart := existingRoles == 0
+
+	for _, defaultRole := range defaultRoles {
+		var role Role
+		query := tx.Where("name = ?", defaultRole.Name).Limit(1).Find(&role)
+		if query.Error != nil {
+			return query.Error
+		}
+		if query.RowsAffected > 0 {
+			continue
+		}
+		role = Role{Name: defaultRole.Name, Description: defaultRole.Description, Permissions: allPermissions}
+		if defaultRole.Permissions != nil {
+			role.Permissions = nil
+			for _, name := range defaultRole.Permissions {
+				role.Permissions = append(role.Permissions, byName[name])
+			}
+		}
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+	}
+
+	var superAdmins int64
+	query := tx.Model(&AdminRole{}).
+		Joins("JOIN roles ON roles.id = admin_roles.role_id").
+		Where("roles.name = ?", RoleSuperAdmin).
+		Count(&superAdmins)
+	if query.Error != nil {
+		return query.Error
+	}
+	seedSuperAdmins := superAdmins == 0
+
+	var admins []Admin
+	if err := tx.Preload("User").Where("status = ?", Active).Find(&admins).Error; err != nil {
+		return err
+	}
+	for _, admin := range admins {
+		if firstStart {
+			if _, err := AssignRole(tx, admin.ID, RoleOperator, Admin{User: User{Name: "system"}}); err != nil {
+				return err
+			}
+		}
+		if seedSuperAdmins && isEmailListed("SUPER_ADMIN_EMAILS", admin.User.Email) {
+			if _, err := AssignRole(tx, admin.ID, RoleSuperAdmin, Admin{User: User{Name: "system"}}); err != nil {
+				return err
+			}
+		}
+	}
+	if firstStart {
+		log.Print("Assigned the ", RoleOperator, " role to ", len(admins), " active admins")
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermissionSetHas(t *testing.T) {
+	set := PermissionSet{PermissionOrdersRead: true, PermissionPricingWrite: true}
+	assert.True(t, set.Has(PermissionOrdersRead))
+	assert.True(t, set.Has(PermissionOrdersRead, PermissionPricingWrite))
+	assert.False(t, set.Has(PermissionOrdersRead, PermissionPricingLarge))
+	assert.False(t, PermissionSet{}.Has(PermissionOrdersRead))
+}
+
+func TestIsEmailListed(t *testing.T) {
+	t.Setenv("SUPER_ADMIN_EMAILS", "finance@itsfood.id; owner@itsfood.id")
+	assert.True(t, isEmailListed("SUPER_ADMIN_EMAILS", "Owner@itsfood.id"))
+	assert.False(t, isEmailListed("SUPER_ADMIN_EMAILS", "operator@itsfood.id"))
+	assert.False(t, isEmailListed("SUPER_ADMIN_EMAILS", ""))
+}
+
+func TestDefaultRolesOnlyUseKnownPermissions(t *testing.T) {
+	known := map[string]bool{}
+	for _, name := range permissionNames {
+		known[name] = true
+	}
+	for _, role := range defaultRoles {
+		for _, name := range role.Permissions {
+			assert.True(t, known[name], role.Name+" uses unknown permission "+name)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventLoginLockout      = "login_lockout"
+	SecurityEventLoginUnlocked     = "login_unlocked"
+)
+
+// SecurityEvent records something suspicious around an account, kept for the
+// admins to look into.
+type SecurityEvent struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	UserID    uint64    `gorm:"column:user_id;not null;index" json:"user_id"`
+	Type      string    `gorm:"column:type;not null;index" json:"type"`
+	SessionID string    `gorm:"column:session_id" json:"session_id"`
+	IP        string    `gorm:"column:ip" json:"ip"`
+	UserAgent string    `gorm:"column:user_agent" json:"user_agent"`
+	Detail    string    `gorm:"column:detail;type:text" json:"detail"`
+	CreatedAt time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (SecurityEvent) TableName() string {
+	return "security_events"
+}
+
+// RecordSecurityEvent stores a security event. Failing to store it must not
+// stop the request which noticed it, so an error is only logged.
+func RecordSecurityEvent(event SecurityEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if err := services.DB.Create(&event).Error; err != nil {
+		log.Print("Failed to record security event ", event.Type, " of user #", event.UserID, ": ", err.Error())
+	}
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// The views below are what the API sends for users, admins, customers and
+// vendors. They never carry a password hash, and the sensitive data of a
+// vendor is only shown in full to an admin who is allowed to see it.
+
+// redactedLength is how many characters at the end of a sensitive value stay
+// readable, so a value can still be recognised.
+const redactedLength = 4
+
+// RedactValue hides all but the last few characters of a sensitive value.
+func RedactValue(value string) string {
+	runes := []rune(value)
+	if len(runes) <= redactedLength {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-redactedLength) + string(runes[len(runes)-redactedLength:])
+}
+
+type UserView struct {
+	ID        uint64       `json:"id"`
+	Name      string       `json:"name"`
+	Email     string       `json:"email"`
+	Phone     string       `json:"phone"`
+	Type      UserCategory `json:"type"`
+	Status    string       `json:"status"`
+	CreatedBy string       `json:"created_by"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+func NewUserView(user User) UserView {
+	return UserView{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Phone:     user.Phone,
+		Type:      user.Type,
+		Status:    user.Status,
+		CreatedBy: user.CreatedBy,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+type AdminView struct {
+	ID        uint64      `json:"id"`
+	UserID    uint64      `json:"user_id"`
+	User      UserView    `json:"user"`
+	Name      string      `json:"name"`
+	Email     string      `json:"email"`
+	Phone     string      `json:"phone"`
+	Status    AdminStatus `json:"status"`
+	CreatedBy string      `json:"created_by"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+func NewAdminView(admin Admin) AdminView {
+	return AdminView{
+		ID:        admin.ID,
+		UserID:    admin.UserID,
+		User:      NewUserView(admin.User),
+		Name:      admin.Name,
+		Email:     admin.Email,
+		Phone:     admin.Phone,
+		Status:    admin.Status,
+		CreatedBy: admin.CreatedBy,
+		CreatedAt: admin.CreatedAt,
+		UpdatedAt: admin.UpdatedAt,
+	}
+}
+
+type CustomerView struct {
+	ID        uint64    `json:"id"`
+	UserID    uint64    `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Type      string    `json:"type"`
+	UnitID    uint64    `json:"unit_id"`
+	UnitName  string    `json:"unit_name"`
+	Status    string    `json:"status"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewCustomerView takes the name and contacts of the customer from its User,
+// and the name of its unit from its Unit.
+func NewCustomerView(customer Customer) CustomerView {
+	return CustomerView{
+		ID:        customer.ID,
+		UserID:    customer.UserID,
+		Name:      customer.User.Name,
+		Email:     customer.User.Email,
+		Phone:     customer.User.Phone,
+		Type:      customer.Type,
+		UnitID:    customer.UnitID,
+		UnitName:  customer.Unit.Name,
+		Status:    customer.Status,
+		CreatedBy: customer.CreatedBy,
+		CreatedAt: customer.CreatedAt,
+		UpdatedAt: customer.UpdatedAt,
+	}
+}
+
+type VendorView struct {
+	ID                   uint64     `json:"id"`
+	UserID               uint64     `json:"user_id"`
+	Name                 string     `json:"name"`
+	Email                string     `json:"email"`
+	CompanyName          string     `json:"company_name"`
+	CompanyType          string     `json:"company_type"`
+	Phone                string     `json:"phone"`
+	Address              string     `json:"address"`
+	Village              string     `json:"village"`
+	District             string     `json:"district"`
+	Regency              string     `json:"regency"`
+	Province             string     `json:"province"`
+	PostalCode           string     `json:"postal_code"`
+	NPWPNumber           string     `json:"npwp_number"`
+	NPWPName             string     `json:"npwp_name"`
+	NPWPAddress          string     `json:"npwp_address"`
+	OfficerName          string     `json:"officer_name"`
+	OfficerPhone         string     `json:"officer_phone"`
+	OfficerPosition      string     `json:"officer_position"`
+	OfficerAddress       string     `json:"officer_address"`
+	OfficerIDNumber      string     `json:"officer_id_number"`
+	PKPNumber            string     `json:"pkp_number"`
+	PKPExpiryDate        *time.Time `json:"pkp_expiry_date"`
+	BankName             string     `json:"bank_name"`
+	BankBranch           string     `json:"bank_branch"`
+	BankAccountNumber    string     `json:"bank_account_number"`
+	BankAccountName      string     `json:"bank_account_name"`
+	VendorMinOrderAmount uint       `json:"vendor_min_order_amount"`
+	VendorMinOrderQty    uint       `json:"vendor_min_order_qty"`
+	VendorDeliveryCost   uint       `json:"vendor_delivery_cost"`
+	VendorServiceCharge  uint       `json:"vendor_service_charge"`
+	VendorMargin         float64    `json:"vendor_margin"`
+	VendorNoteForMenus   string     `json:"vendor_note_for_menus"`
+	VendorTelegramID     string     `json:"vendor_telegram_id"`
+	Status               string     `json:"status"`
+	// Redacted tells whether the sensitive fields were hidden.
+	Redacted  bool      `json:"redacted"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewVendorView takes the name and email of the vendor from its User. The NPWP
+// number, officer ID number and bank account number are redacted unless
+// revealSensitive is set.
+func NewVendorView(vendor Vendor, revealSensitive bool) VendorView {
+	view := VendorView{
+		ID:                   vendor.ID,
+		UserID:               vendor.UserID,
+		Name:                 vendor.User.Name,
+		Email:                vendor.User.Email,
+		CompanyName:          vendor.CompanyName,
+		CompanyType:          vendor.CompanyType,
+		Phone:                vendor.Phone,
+		Address:              vendor.Address,
+		Village:              vendor.Village,
+		District:             vendor.District,
+		Regency:              vendor.Regency,
+		Province:             vendor.Province,
+		PostalCode:           vendor.PostalCode,
+		NPWPNumber:           vendor.NPWPNumber,
+		NPWPName:             vendor.NPWPName,
+		NPWPAddress:          vendor.NPWPAddress,
+		OfficerName:          vendor.OfficerName,
+		OfficerPhone:         vendor.OfficerPhone,
+		OfficerPosition:      vendor.OfficerPosition,
+		OfficerAddress:       vendor.OfficerAddress,
+		OfficerIDNumber:      vendor.OfficerIDNumber,
+		PKPNumber:            vendor.PKPNumber,
+		BankName:             vendor.BankName,
+		BankBranch:           vendor.BankBranch,
+		BankAccountNumber:    vendor.BankAccountNumber,
+		BankAccountName:      vendor.BankAccountName,
+		VendorMinOrderAmount: vendor.VendorMinOrderAmount,
+		VendorMinOrderQty:    vendor.VendorMinOrderQty,
+		VendorDeliveryCost:   vendor.VendorDeliveryCost,
+		VendorServiceCharge:  vendor.VendorServiceCharge,
+		VendorMargin:         vendor.VendorMargin,
+		VendorNoteForMenus:   vendor.VendorNoteForMenus,
+		VendorTelegramID:     vendor.VendorTelegramID,
+		Status:               vendor.Status,
+		CreatedBy:            vendor.CreatedBy,
+		CreatedAt:            vendor.CreatedAt,
+		UpdatedAt:            vendor.UpdatedAt,
+	}
+	if !vendor.PKPExpiryDate.IsZero() {
+		pkpExpiryDate := vendor.PKPExpiryDate
+		view.PKPExpiryDate = &pkpExpiryDate
+	}
+	if !revealSensitive {
+		view.NPWPNumber = RedactValue(view.NPWPNumber)
+		view.OfficerIDNumber = RedactValue(view.OfficerIDNumber)
+		view.BankAccountNumber = RedactValue(view.BankAccountNumber)
+		view.Redacted = true
+	}
+	return view
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactValue(t *testing.T) {
+	assert.Equal(t, "", RedactValue(""))
+	assert.Equal(t, "***", RedactValue("123"))
+	assert.Equal(t, "******7890", RedactValue("1234567890"))
+}
+
+func TestViewsNeverCarryPasswords(t *testing.T) {
+	admin := Admin{ID: 1, User: User{ID: 2, Email: "admin@itsfood.id", Password: "$2a$10$hash"}}
+
+	encoded, err := json.Marshal(NewAdminView(admin))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(encoded), "$2a$10$hash")
+
+	encoded, err = json.Marshal(admin)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(encoded), "$2a$10$hash")
+}
+
+func TestNewVendorViewRedactsSensitiveData(t *testing.T) {
+	vendor := Vendor{
+		NPWPNumber:        "012345678901000",
+		OfficerIDNumber:   "3578000000000001",
+		BankAccountNumber: "1400012345",
+		BankAccountName:   "Dapur Bu Sri",
+		User:              User{Name: "Dapur Bu Sri", Password: "$2a$10$hash"},
+	}
+
+	view := NewVendorView(vendor, false)
+	assert.True(t, view.Redacted)
+	assert.Equal(t, "***********1000", view.NPWPNumber)
+	assert.Equal(t, "************0001", view.OfficerIDNumber)
+	assert.Equal(t, "******2345", view.BankAccountNumber)
+	assert.Equal(t, "Dapur Bu Sri", view.BankAccountName)
+	assert.Nil(t, view.PKPExpiryDate)
+
+	view = NewVendorView(vendor, true)
+	assert.False(t, view.Redacted)
+	assert.Equal(t, "1400012345", view.BankAccountNumber)
+}
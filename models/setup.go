@@ -1,5 +1,40 @@
 package models
 
+import (
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
 type Tabler interface {
 	TableName() string
-}
\ No newline at end of file
+}
+
+// Migrate creates the tables owned by this service and the default roles. The
+// tables shared with the other ITS Food services are left alone.
+func Migrate() error {
+	err := services.DB.AutoMigrate(
+		&OrderPricing{},
+		&VendorDump{},
+		&MenuPrice{},
+		&RuleOverride{},
+		&VendorNotification{},
+		&VendorResponse{},
+		&Notification{},
+		&MessageTemplate{},
+		&SecurityEvent{},
+		&AdminTwoFactor{},
+		&Setting{},
+		&AdminApproval{},
+		&Permission{},
+		&Role{},
+		&AdminRole{},
+		&AdminDump{},
+	)
+	if err != nil {
+		return err
+	}
+	return services.DB.Transaction(func(tx *gorm.DB) error {
+		return seedRoles(tx)
+	})
+}
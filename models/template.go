@@ -0,0 +1,278 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+	"github.com/adeindriawan/itsfood-administration/templates"
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+// partialsTemplate defines the blocks shared by every text template.
+const partialsTemplate = "_partials.txt"
+
+// ErrTemplateNotFound is returned for a name which is not one of the
+// templates built into the binary.
+var ErrTemplateNotFound = errors.New("template tidak ditemukan")
+
+// MessageTemplate replaces the template of the same name which is built into
+// the binary, so a message can be reworded without a deploy.
+type MessageTemplate struct {
+	Name      string    `gorm:"primaryKey;size:100" json:"name"`
+	Body      string    `gorm:"column:body;type:text;not null" json:"body"`
+	UpdatedAt time.Time `gorm:"column:updated_at;not null" json:"updated_at"`
+	UpdatedBy string    `gorm:"column:updated_by;not null" json:"updated_by"`
+}
+
+func (MessageTemplate) TableName() string {
+	return "message_templates"
+}
+
+type RenderedMessage struct {
+	Subject string
+	Body    string
+}
+
+// templateSource is one place a template is read from.
+type templateSource struct {
+	Origin string
+	Body   string
+}
+
+func templateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"date": func(date time.Time) string {
+			return utils.ConvertDateToPhrase(date, false)
+		},
+		"datetime": func(date time.Time) string {
+			return utils.ConvertDateToPhrase(date, true)
+		},
+		"rupiah": func(amount interface{}) (string, error) {
+			value := reflect.ValueOf(amount)
+			switch value.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return utils.FormatRupiah(value.Int()), nil
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				return utils.FormatRupiah(int64(value.Uint())), nil
+			case reflect.Float32, reflect.Float64:
+				return utils.FormatRupiah(int64(value.Float())), nil
+			}
+			return "", errors.New("rupiah: nilai bukan angka")
+		},
+	}
+}
+
+// IsKnownTemplate tells whether name is one of the templates built into the
+// binary. Only those can be replaced.
+func IsKnownTemplate(name string) bool {
+	_, err := fs.Stat(templates.Files, name)
+	return err == nil
+}
+
+// TemplateNames lists every template built into the binary.
+func TemplateNames() []string {
+	names, _ := fs.Glob(templates.Files, "*.*")
+	sort.Strings(names)
+	return names
+}
+
+// templateSources lists where name can be read from, the one to use first
+// coming first: the database, TEMPLATES_DIR, and the binary.
+func templateSources(name string) []templateSource {
+	var sources []templateSource
+
+	if services.DB != nil {
+		var messageTemplate MessageTemplate
+		query := services.DB.Where("name = ?", name).Limit(1).Find(&messageTemplate)
+		if query.Error != nil {
+			log.Print("Failed to read template ", name, " from the database: ", query.Error.Error())
+		} else if query.RowsAffected > 0 {
+			sources = append(sources, templateSource{Origin: "database", Body: messageTemplate.Body})
+		}
+	}
+
+	if dir := os.Getenv("TEMPLATES_DIR"); dir != "" {
+		if body, err := os.ReadFile(filepath.Join(dir, filepath.Base(name))); err == nil {
+			sources = append(sources, templateSource{Origin: "file", Body: string(body)})
+		}
+	}
+
+	if body, err := fs.ReadFile(templates.Files, name); err == nil {
+		sources = append(sources, templateSource{Origin: "default", Body: string(body)})
+	}
+
+	return sources
+}
+
+// renderTemplate parses body as the template called name and executes it with
+// data. Text templates can use the blocks defined in partials.
+func renderTemplate(name string, body string, partials string, data interface{}) (RenderedMessage, error) {
+	var rendered RenderedMessage
+	var bodyBuffer, subjectBuffer bytes.Buffer
+
+	if strings.HasSuffix(name, ".html") {
+		tmpl, err := htmltemplate.New(name).Funcs(templateFuncs()).Parse(body)
+		if err != nil {
+			return rendered, err
+		}
+		if err := tmpl.Execute(&bodyBuffer, data); err != nil {
+			return rendered, err
+		}
+		if tmpl.Lookup("subject") != nil {
+			if err := tmpl.ExecuteTemplate(&subjectBuffer, "subject", data); err != nil {
+				return rendered, err
+			}
+		}
+	} else {
+		tmpl, err := texttemplate.New(name).Funcs(templateFuncs()).Parse(partials)
+		if err != nil {
+			return rendered, err
+		}
+		if tmpl, err = tmpl.Parse(body); err != nil {
+			return rendered, err
+		}
+		if err := tmpl.Execute(&bodyBuffer, data); err != nil {
+			return rendered, err
+		}
+		if tmpl.Lookup("subject") != nil {
+			if err := tmpl.ExecuteTemplate(&subjectBuffer, "subject", data); err != nil {
+				return rendered, err
+			}
+		}
+	}
+
+	rendered.Subject = strings.TrimSpace(subjectBuffer.String())
+	rendered.Body = strings.TrimSpace(bodyBuffer.String())
+	return rendered, nil
+}
+
+func partialsBody() string {
+	for _, source := range templateSources(partialsTemplate) {
+		if _, err := texttemplate.New(partialsTemplate).Funcs(templateFuncs()).Parse(source.Body); err == nil {
+			return source.Body
+		}
+	}
+	return ""
+}
+
+// ParseTemplate checks that body is a valid template to be saved as name.
+func ParseTemplate(name string, body string) error {
+	if name == partialsTemplate {
+		_, err := texttemplate.New(name).Funcs(templateFuncs()).Parse(body)
+		return err
+	}
+	if strings.HasSuffix(name, ".html") {
+		_, err := htmltemplate.New(name).Funcs(templateFuncs()).Parse(body)
+		return err
+	}
+	tmpl, err := texttemplate.New(name).Funcs(templateFuncs()).Parse(partialsBody())
+	if err != nil {
+		return err
+	}
+	_, err = tmpl.Parse(body)
+	return err
+}
+
+// RenderMessage renders the template called name with data. A replaced
+// template which fails is logged and the next one in line is used, so a bad
+// edit does not stop messages from going out.
+func RenderMessage(name string, data interface{}) (RenderedMessage, error) {
+	sources := templateSources(name)
+	if len(sources) == 0 {
+		return RenderedMessage{}, ErrTemplateNotFound
+	}
+
+	partials := partialsBody()
+	var err error
+	for _, source := range sources {
+		var rendered RenderedMessage
+		rendered, err = renderTemplate(name, source.Body, partials, data)
+		if err == nil {
+			return rendered, nil
+		}
+		log.Print("Failed to render template ", name, " from ", source.Origin, ": ", err.Error())
+	}
+	return RenderedMessage{}, err
+}
+
+// NotifyTemplate renders a template and queues it for recipient on channel.
+func NotifyTemplate(channel string, recipient string, name string, data interface{}) {
+	message, err := RenderMessage(name, data)
+	if err != nil {
+		log.Print("Failed to render template ", name, ": ", err.Error())
+		return
+	}
+	Notify(channel, recipient, message.Subject, message.Body)
+}
+
+// NotifyGroupTemplate renders a template and queues it for the telegram group
+// of the admins.
+func NotifyGroupTemplate(name string, data interface{}) {
+	NotifyTemplate(services.ChannelTelegram, "", name, data)
+}
+
+// TemplateInfo describes a template as it is used now, next to the default
+// built into the binary.
+type TemplateInfo struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Body    string `json:"body,omitempty"`
+	Default string `json:"default,omitempty"`
+}
+
+// GetTemplate describes the template called name, which has to be known.
+func GetTemplate(name string) (TemplateInfo, error) {
+	if !IsKnownTemplate(name) {
+		return TemplateInfo{}, ErrTemplateNotFound
+	}
+	sources := templateSources(name)
+	info := TemplateInfo{Name: name, Source: sources[0].Origin, Body: sources[0].Body}
+	info.Default = sources[len(sources)-1].Body
+	return info, nil
+}
+
+// TemplateParseError is returned when a template to be saved does not parse.
+type TemplateParseError struct {
+	Err error
+}
+
+func (e TemplateParseError) Error() string {
+	return "template tidak valid: " + e.Err.Error()
+}
+
+// SaveTemplate replaces the template called name with body, after checking
+// that body parses.
+func SaveTemplate(tx *gorm.DB, name string, body string, by string) (MessageTemplate, error) {
+	messageTemplate := MessageTemplate{Name: name, Body: body, UpdatedAt: time.Now(), UpdatedBy: by}
+	if !IsKnownTemplate(name) {
+		return messageTemplate, ErrTemplateNotFound
+	}
+	if err := ParseTemplate(name, body); err != nil {
+		return messageTemplate, TemplateParseError{Err: err}
+	}
+	err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&messageTemplate).Error
+	return messageTemplate, err
+}
+
+// ResetTemplate drops the replacement of the template called name from the
+// database, so TEMPLATES_DIR or the default is used again.
+func ResetTemplate(tx *gorm.DB, name string) error {
+	if !IsKnownTemplate(name) {
+		return ErrTemplateNotFound
+	}
+	return tx.Where("name = ?", name).Delete(&MessageTemplate{}).Error
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMessageUsesHelpersAndPartials(t *testing.T) {
+	message, err := RenderMessage("order_cost_added.txt", map[string]interface{}{
+		"Amount": uint64(1500000), "Reason": "Ongkir", "Menu": "Nasi Goreng", "OrderID": 12, "Admin": "Budi",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada biaya sebesar Rp1.500.000 ditambahkan dengan keterangan: Ongkir, pada menu Nasi Goreng di order ID #12 oleh Budi", message.Body)
+
+	message, err = RenderMessage("order_qty_changed.txt", map[string]interface{}{
+		"OrderID": 12, "Menu": "Nasi Goreng", "OldQty": 10, "NewQty": 2, "Admin": "Budi",
+		"Override": map[string]interface{}{
+			"Violations": []RuleViolation{{Message: "Menu Nasi Goreng minimal dipesan 5 porsi."}},
+			"Reason":     "Permintaan customer",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, message.Body, "diganti dari 10 porsi menjadi 2 porsi oleh Budi")
+	assert.Contains(t, message.Body, "\"Permintaan customer\":\n- Menu Nasi Goreng minimal dipesan 5 porsi.")
+}
+
+func TestRenderMessageHTMLSubject(t *testing.T) {
+	message, err := RenderMessage("password_reset.html", map[string]interface{}{"Name": "<Budi>", "Link": "https://admin.itsfood.my.id/reset?token=a&email=b", "ExpiresIn": 15})
+	assert.NoError(t, err)
+	assert.Equal(t, "[ITS Food] Lupa Kata Sandi", message.Subject)
+	assert.Contains(t, message.Body, "&lt;Budi&gt;")
+	assert.Contains(t, message.Body, `href="https://admin.itsfood.my.id/reset?token=a&amp;email=b"`)
+	assert.NotContains(t, message.Body, "define")
+}
+
+func TestRenderMessageFallsBackFromBrokenOverride(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "vendor_created.txt"), []byte("Vendor {{.Vendor.Missing}}"), 0644))
+	t.Setenv("TEMPLATES_DIR", dir)
+
+	message, err := RenderMessage("vendor_created.txt", map[string]interface{}{"Vendor": "Dapur Bu Sri", "Admin": "Budi"})
+	assert.NoError(t, err)
+	assert.Contains(t, message.Body, "Dapur Bu Sri")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "vendor_created.txt"), []byte("Vendor {{.Vendor}} oleh {{.Admin}}"), 0644))
+	message, err = RenderMessage("vendor_created.txt", map[string]interface{}{"Vendor": "Dapur Bu Sri", "Admin": "Budi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Vendor Dapur Bu Sri oleh Budi", message.Body)
+}
+
+func TestParseTemplate(t *testing.T) {
+	assert.True(t, IsKnownTemplate("_partials.txt"))
+	assert.False(t, IsKnownTemplate("unknown.txt"))
+	assert.NoError(t, ParseTemplate("order_qty_changed.txt", `{{.OrderID}}{{template "rule_override" .Override}}`))
+	assert.Error(t, ParseTemplate("order_qty_changed.txt", "{{.OrderID"))
+}
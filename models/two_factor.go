@@ -0,0 +1,254 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+	"github.com/adeindriawan/itsfood-administration/utils"
+)
+
+const (
+	// the issuer shown in the authenticator app
+	twoFactorIssuer   = "ITS Food"
+	recoveryCodeCount = 10
+	// settings
+	SettingRequireTwoFactor = "require_two_factor"
+)
+
+// AdminTwoFactor is the TOTP enrollment of an admin. It is pending until the
+// admin proves the authenticator works by sending a code.
+type AdminTwoFactor struct {
+	AdminID uint64 `gorm:"primaryKey;autoIncrement:false" json:"admin_id"`
+	Secret  string `gorm:"column:secret;not null" json:"-"`
+	Enabled bool   `gorm:"column:enabled;not null" json:"enabled"`
+	// RecoveryCodes holds the bcrypt hashes of the unused recovery codes, as
+	// a JSON array.
+	RecoveryCodes string     `gorm:"column:recovery_codes;type:text" json:"-"`
+	EnabledAt     *time.Time `gorm:"column:enabled_at" json:"enabled_at"`
+	CreatedAt     time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at;not null" json:"updated_at"`
+}
+
+func (AdminTwoFactor) TableName() string {
+	return "admin_two_factors"
+}
+
+// RemainingRecoveryCodes is how many recovery codes are left.
+func (twoFactor AdminTwoFactor) RemainingRecoveryCodes() int {
+	var hashes []string
+	json.Unmarshal([]byte(twoFactor.RecoveryCodes), &hashes)
+	return len(hashes)
+}
+
+// Setting is a switch of the service which admins can change at runtime.
+type Setting struct {
+	Key       string    `gorm:"primaryKey;size:100" json:"key"`
+	Value     string    `gorm:"column:value;not null" json:"value"`
+	UpdatedBy string    `gorm:"column:updated_by;not null" json:"updated_by"`
+	UpdatedAt time.Time `gorm:"column:updated_at;not null" json:"updated_at"`
+}
+
+func (Setting) TableName() string {
+	return "settings"
+}
+
+func SaveSetting(tx *gorm.DB, key string, value string, by string) (Setting, error) {
+	setting := Setting{Key: key, Value: value, UpdatedBy: by, UpdatedAt: time.Now()}
+	err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&setting).Error
+	return setting, err
+}
+
+// IsTwoFactorRequired tells whether every admin has to use 2FA.
+func IsTwoFactorRequired() (bool, error) {
+	var setting Setting
+	query := services.DB.Where("`key` = ?", SettingRequireTwoFactor).Limit(1).Find(&setting)
+	if query.Error != nil {
+		return false, query.Error
+	}
+	return setting.Value == "true", nil
+}
+
+// GetAdminTwoFactor loads the enrollment of an admin. An admin who never
+// enrolled gets an empty one, which is not enabled.
+func GetAdminTwoFactor(adminId uint64) (AdminTwoFactor, error) {
+	var twoFactor AdminTwoFactor
+	err := services.DB.Where("admin_id = ?", adminId).Limit(1).Find(&twoFactor).Error
+	return twoFactor, err
+}
+
+// EnrollTwoFactor gives an admin a new secret, pending until it is verified.
+// An admin who already uses 2FA has to disable it first.
+func EnrollTwoFactor(tx *gorm.DB, admin Admin) (AdminTwoFactor, string, error) {
+	var twoFactor AdminTwoFactor
+	if err := tx.Where("admin_id = ?", admin.ID).Limit(1).Find(&twoFactor).Error; err != nil {
+		return twoFactor, "", err
+	}
+	if twoFactor.Enabled {
+		return twoFactor, "", AdminAccountError{"2FA sudah aktif, nonaktifkan terlebih dahulu untuk mendaftarkan ulang"}
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return twoFactor, "", err
+	}
+	now := time.Now()
+	twoFactor = AdminTwoFactor{AdminID: admin.ID, Secret: secret, CreatedAt: now, UpdatedAt: now}
+	if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&twoFactor).Error; err != nil {
+		return twoFactor, "", err
+	}
+	return twoFactor, utils.TOTPURI(secret, twoFactorIssuer, admin.User.Email), nil
+}
+
+// lockTwoFactor holds the enrollment row being read until tx ends, so two
+// requests cannot both spend the same recovery code.
+func lockTwoFactor(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+func totpUsedKey(adminId uint64, step int64) string {
+	return "totp-used:" + strconv.FormatUint(adminId, 10) + ":" + strconv.FormatInt(step, 10)
+}
+
+// checkTOTP validates a code of an admin and makes sure it is used only once.
+func checkTOTP(twoFactor AdminTwoFactor, code string) bool {
+	step, valid := utils.ValidateTOTP(twoFactor.Secret, code, time.Now())
+	if !valid {
+		return false
+	}
+	// a code stays valid for a few steps, so it is remembered as long
+	fresh, err := services.GetRedis().SetNX(totpUsedKey(twoFactor.AdminID, step), "1", 3*30*time.Second).Result()
+	return err == nil && fresh
+}
+
+func newRecoveryCodes() ([]string, string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, "", err
+	}
+	var hashes []string
+	for _, code := range codes {
+		hash, err := utils.HashPassword(code)
+		if err != nil {
+			return nil, "", err
+		}
+		hashes = append(hashes, hash)
+	}
+	encoded, err := json.Marshal(hashes)
+	return codes, string(encoded), err
+}
+
+// VerifyTwoFactor turns on the pending enrollment of an admin once code
+// matches, and returns the recovery codes to be shown once.
+func VerifyTwoFactor(tx *gorm.DB, adminId uint64, code string) ([]string, error) {
+	var twoFactor AdminTwoFactor
+	if err := lockTwoFactor(tx).Where("admin_id = ?", adminId).First(&twoFactor).Error; err != nil {
+		return nil, err
+	}
+	if twoFactor.Enabled {
+		return nil, AdminAccountError{"2FA sudah aktif"}
+	}
+	if !checkTOTP(twoFactor, code) {
+		return nil, AdminAccountError{"kode 2FA tidak valid"}
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	update := map[string]interface{}{
+		"enabled":        true,
+		"enabled_at":     now,
+		"recovery_codes": hashes,
+		"updated_at":     now,
+	}
+	if err := tx.Model(&twoFactor).Updates(update).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useRecoveryCode crosses out a recovery code of an admin when it matches one
+// which was not used yet.
+func useRecoveryCode(tx *gorm.DB, twoFactor AdminTwoFactor, code string) (bool, error) {
+	var hashes []string
+	if err := json.Unmarshal([]byte(twoFactor.RecoveryCodes), &hashes); err != nil {
+		return false, err
+	}
+	code = strings.ToLower(strings.TrimSpace(code))
+	for i, hash := range hashes {
+		if !utils.CheckPasswordHash(code, hash) {
+			continue
+		}
+		remaining := append(hashes[:i:i], hashes[i+1:]...)
+		encoded, err := json.Marshal(remaining)
+		if err != nil {
+			return false, err
+		}
+		update := map[string]interface{}{"recovery_codes": string(encoded), "updated_at": time.Now()}
+		return true, tx.Model(&twoFactor).Updates(update).Error
+	}
+	return false, nil
+}
+
+// CheckTwoFactor checks the second factor of an admin who uses 2FA: either a
+// code from the authenticator or one of the recovery codes.
+func CheckTwoFactor(tx *gorm.DB, adminId uint64, code string, recoveryCode string) error {
+	var twoFactor AdminTwoFactor
+	if err := lockTwoFactor(tx).Where("admin_id = ? AND enabled = ?", adminId, true).First(&twoFactor).Error; err != nil {
+		return err
+	}
+	if code != "" && checkTOTP(twoFactor, code) {
+		return nil
+	}
+	if recoveryCode != "" {
+		used, err := useRecoveryCode(tx, twoFactor, recoveryCode)
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+	}
+	return AdminAccountError{"kode 2FA tidak valid"}
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of an admin, after the
+// admin proves it still has the authenticator.
+func RegenerateRecoveryCodes(tx *gorm.DB, adminId uint64, code string) ([]string, error) {
+	var twoFactor AdminTwoFactor
+	if err := lockTwoFactor(tx).Where("admin_id = ? AND enabled = ?", adminId, true).First(&twoFactor).Error; err != nil {
+		return nil, err
+	}
+	if !checkTOTP(twoFactor, code) {
+		return nil, AdminAccountError{"kode 2FA tidak valid"}
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	update := map[string]interface{}{"recovery_codes": hashes, "updated_at": time.Now()}
+	return codes, tx.Model(&twoFactor).Updates(update).Error
+}
+
+// DisableTwoFactor turns 2FA off for an admin, which is not allowed while
+// every admin is required to use it.
+func DisableTwoFactor(tx *gorm.DB, adminId uint64, code string, recoveryCode string) error {
+	required, err := IsTwoFactorRequired()
+	if err != nil {
+		return err
+	}
+	if required {
+		return AdminAccountError{"2FA wajib digunakan oleh semua admin"}
+	}
+	if err := CheckTwoFactor(tx, adminId, code, recoveryCode); err != nil {
+		return err
+	}
+	return tx.Where("admin_id = ?", adminId).Delete(&AdminTwoFactor{}).Error
+}
@@ -26,7 +26,7 @@ type User struct {
 	ID uint64						`gorm:"primaryKey" json:"id"`
 	Name string 				`gorm:"column:name;not null" json:"name"`
 	Email string				`gorm:"column:email;not null" json:"email"`
-	Password string	 		`gorm:"column:password;not null" json:"password"`
+	Password string	 		`gorm:"column:password;not null" json:"-"`
 	Phone string 				`gorm:"column:phone;not null" json:"phone"`
 	Type UserCategory		`gorm:"type:ENUM('Customer', 'Vendor', 'Admin');column:type" json:"type"`
 	Status string 			`gorm:"column:status;not null" json:"status"`
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Vendor struct {
@@ -42,4 +44,118 @@ type Vendor struct {
 	CreatedBy string 					`gorm:"column:created_by;not null" json:"created_by"`
 	CreatedAt time.Time 			`gorm:"column:created_at" json:"created_at"`
 	UpdatedAt time.Time				`gorm:"column:updated_at;autoUpdateTime:false" json:"updated_at"`			
-}
\ No newline at end of file
+}
+
+type VendorDump struct {
+	ID                   uint64     `gorm:"primaryKey" json:"id"`
+	SourceID             uint64     `gorm:"column:source_id;not null;index" json:"source_id"`
+	CompanyName          string     `gorm:"column:company_name" json:"company_name"`
+	CompanyType          string     `gorm:"column:company_type" json:"company_type"`
+	Phone                string     `gorm:"column:phone" json:"phone"`
+	Address              string     `gorm:"column:address" json:"address"`
+	Village              string     `gorm:"column:village" json:"village"`
+	District             string     `gorm:"column:district" json:"district"`
+	Regency              string     `gorm:"column:regency" json:"regency"`
+	Province             string     `gorm:"column:province" json:"province"`
+	PostalCode           string     `gorm:"column:postal_code" json:"postal_code"`
+	NPWPNumber           string     `gorm:"column:npwp_number" json:"npwp_number"`
+	NPWPName             string     `gorm:"column:npwp_name" json:"npwp_name"`
+	NPWPAddress          string     `gorm:"column:npwp_address" json:"npwp_address"`
+	OfficerName          string     `gorm:"column:officer_name" json:"officer_name"`
+	OfficerPhone         string     `gorm:"column:officer_phone" json:"officer_phone"`
+	OfficerPosition      string     `gorm:"column:officer_position" json:"officer_position"`
+	OfficerAddress       string     `gorm:"column:officer_address" json:"officer_address"`
+	OfficerIDNumber      string     `gorm:"column:officer_id_number" json:"officer_id_number"`
+	PKPNumber            string     `gorm:"column:pkp_number" json:"pkp_number"`
+	PKPExpiryDate        *time.Time `gorm:"column:pkp_expiry_date" json:"pkp_expiry_date"`
+	BankName             string     `gorm:"column:bank_name" json:"bank_name"`
+	BankBranch           string     `gorm:"column:bank_branch" json:"bank_branch"`
+	BankAccountNumber    string     `gorm:"column:bank_account_number" json:"bank_account_number"`
+	BankAccountName      string     `gorm:"column:bank_account_name" json:"bank_account_name"`
+	VendorMinOrderAmount uint       `gorm:"column:vendor_min_order_amount" json:"vendor_min_order_amount"`
+	VendorMinOrderQty    uint       `gorm:"column:vendor_min_order_qty" json:"vendor_min_order_qty"`
+	VendorDeliveryCost   uint       `gorm:"column:vendor_delivery_cost" json:"vendor_delivery_cost"`
+	VendorServiceCharge  uint       `gorm:"column:vendor_service_charge" json:"vendor_service_charge"`
+	VendorMargin         float64    `gorm:"column:vendor_margin" json:"vendor_margin"`
+	VendorNoteForMenus   string     `gorm:"column:vendor_note_for_menus" json:"vendor_note_for_menus"`
+	VendorTelegramID     string     `gorm:"column:vendor_telegram_id" json:"vendor_telegram_id"`
+	Status               string     `gorm:"column:status;not null" json:"status"`
+	UserID               uint64     `gorm:"column:user_id;not null" json:"user_id"`
+	CreatedBy            string     `gorm:"column:created_by;not null" json:"created_by"`
+	CreatedAt            time.Time  `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt            time.Time  `gorm:"column:updated_at;autoUpdateTime:false" json:"updated_at"`
+}
+
+func (VendorDump) TableName() string {
+	return "__vendors"
+}
+
+func newVendorDump(item Vendor) VendorDump {
+	// a vendor without PKP has no expiry date, which is dumped as NULL
+	var pkpExpiryDate *time.Time
+	if !item.PKPExpiryDate.IsZero() {
+		pkpExpiryDate = &item.PKPExpiryDate
+	}
+	return VendorDump{
+		SourceID:             item.ID,
+		CompanyName:          item.CompanyName,
+		CompanyType:          item.CompanyType,
+		Phone:                item.Phone,
+		Address:              item.Address,
+		Village:              item.Village,
+		District:             item.District,
+		Regency:              item.Regency,
+		Province:             item.Province,
+		PostalCode:           item.PostalCode,
+		NPWPNumber:           item.NPWPNumber,
+		NPWPName:             item.NPWPName,
+		NPWPAddress:          item.NPWPAddress,
+		OfficerName:          item.OfficerName,
+		OfficerPhone:         item.OfficerPhone,
+		OfficerPosition:      item.OfficerPosition,
+		OfficerAddress:       item.OfficerAddress,
+		OfficerIDNumber:      item.OfficerIDNumber,
+		PKPNumber:            item.PKPNumber,
+		PKPExpiryDate:        pkpExpiryDate,
+		BankName:             item.BankName,
+		BankBranch:           item.BankBranch,
+		BankAccountNumber:    item.BankAccountNumber,
+		BankAccountName:      item.BankAccountName,
+		VendorMinOrderAmount: item.VendorMinOrderAmount,
+		VendorMinOrderQty:    item.VendorMinOrderQty,
+		VendorDeliveryCost:   item.VendorDeliveryCost,
+		VendorServiceCharge:  item.VendorServiceCharge,
+		VendorMargin:         item.VendorMargin,
+		VendorNoteForMenus:   item.VendorNoteForMenus,
+		VendorTelegramID:     item.VendorTelegramID,
+		Status:               item.Status,
+		UserID:               item.UserID,
+		CreatedBy:            item.CreatedBy,
+		CreatedAt:            item.CreatedAt,
+		UpdatedAt:            item.UpdatedAt,
+	}
+}
+
+// UpdateVendor dumps the current version of the matching vendors and then
+// applies update to them, in one transaction on tx like UpdateOrder.
+func UpdateVendor(tx *gorm.DB, params map[string]interface{}, update map[string]interface{}) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var vendors []Vendor
+		if err := tx.Find(&vendors, params).Error; err != nil {
+			return err
+		}
+		if len(vendors) == 0 {
+			return nil
+		}
+
+		// create dump
+		for _, item := range vendors {
+			vendorDump := newVendorDump(item)
+			if err := tx.Create(&vendorDump).Error; err != nil {
+				return err
+			}
+		}
+		// update record
+		return tx.Model(&vendors).Updates(update).Error
+	})
+}
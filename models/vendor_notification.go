@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+const (
+	ChannelTelegram = services.ChannelTelegram
+	ChannelWhatsapp = services.ChannelWhatsapp
+)
+
+// VendorNotification records how a vendor was told about an order detail and
+// whether the message got through. A WhatsApp link still has to be opened by
+// an admin, so it is never recorded as delivered.
+type VendorNotification struct {
+	ID            uint64    `gorm:"primaryKey" json:"id"`
+	OrderDetailID uint64    `gorm:"column:order_detail_id;not null;index" json:"order_detail_id"`
+	OrderID       uint64    `gorm:"column:order_id;not null;index" json:"order_id"`
+	VendorID      uint64    `gorm:"column:vendor_id;not null" json:"vendor_id"`
+	Channel       string    `gorm:"column:channel;not null" json:"channel"`
+	Delivered     bool      `gorm:"column:delivered;not null" json:"delivered"`
+	Error         string    `gorm:"column:error" json:"error"`
+	CreatedAt     time.Time `gorm:"column:created_at;not null" json:"created_at"`
+	CreatedBy     string    `gorm:"column:created_by;not null" json:"created_by"`
+}
+
+func (VendorNotification) TableName() string {
+	return "vendor_notifications"
+}
+
+// RecordVendorNotification stores one notification for every given order
+// detail of an order to a vendor.
+func RecordVendorNotification(tx *gorm.DB, orderId uint64, vendorId uint64, orderDetailIds []uint64, channel string, errSending error, createdBy string) ([]VendorNotification, error) {
+	var notifications []VendorNotification
+	now := time.Now()
+	for _, orderDetailId := range orderDetailIds {
+		notification := VendorNotification{
+			OrderDetailID: orderDetailId,
+			OrderID:       orderId,
+			VendorID:      vendorId,
+			Channel:       channel,
+			Delivered:     channel == ChannelTelegram && errSending == nil,
+			CreatedAt:     now,
+			CreatedBy:     createdBy,
+		}
+		if errSending != nil {
+			notification.Error = errSending.Error()
+		}
+		notifications = append(notifications, notification)
+	}
+	if len(notifications) == 0 {
+		return notifications, nil
+	}
+	return notifications, tx.Create(&notifications).Error
+}
+
+const (
+	VendorActionAccept    = "accept"
+	VendorActionReject    = "reject"
+	VendorActionReady     = "ready"
+	VendorActionDelivered = "delivered"
+)
+
+// VendorResponse records a vendor answering an order notification through the
+// buttons of the telegram bot.
+type VendorResponse struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	OrderID   uint64    `gorm:"column:order_id;not null;index" json:"order_id"`
+	VendorID  uint64    `gorm:"column:vendor_id;not null" json:"vendor_id"`
+	Action    string    `gorm:"column:action;not null" json:"action"`
+	Reason    string    `gorm:"column:reason" json:"reason"`
+	ChatID    string    `gorm:"column:chat_id;not null" json:"chat_id"`
+	CreatedAt time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (VendorResponse) TableName() string {
+	return "vendor_responses"
+}
@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/adeindriawan/itsfood-administration/controllers"
+	"github.com/adeindriawan/itsfood-administration/middlewares"
+	"github.com/adeindriawan/itsfood-administration/models"
+)
+
+// Setup registers every route of the service on r.
+func Setup(r *gin.Engine) {
+	r.GET("/", func(c *gin.Context) {
+		response := "This is Itsfood Administration Service API Homepage."
+		c.Data(200, "text/html; charset: utf-8", []byte(response))
+	})
+
+	authorized := r.Group("/")
+	authorized.Use(middlewares.Authorized())
+	{
+		authorized.GET("/dummy/authorized", controllers.DummyAuthorizedController)
+		authorizedAdmin := authorized.Group("/")
+		authorizedAdmin.Use(middlewares.AuthorizedAdmin())
+		{
+			authorizedAdmin.GET("/dummy/authorized/admin", controllers.DummyAuthorizedAdminController)
+			authorizedAdmin.GET("/auth/sessions", controllers.GetMySessions)
+			authorizedAdmin.DELETE("/auth/sessions", controllers.RevokeMySessions)
+			authorizedAdmin.DELETE("/auth/sessions/:id", controllers.RevokeMySession)
+			authorizedAdmin.GET("/auth/2fa", controllers.GetTwoFactor)
+			authorizedAdmin.POST("/auth/2fa/enroll", controllers.EnrollTwoFactor)
+			authorizedAdmin.POST("/auth/2fa/verify", controllers.VerifyTwoFactor)
+			authorizedAdmin.POST("/auth/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+			authorizedAdmin.DELETE("/auth/2fa", controllers.DisableTwoFactor)
+			authorizedAdmin.PUT("/auth/password", controllers.ChangeMyPassword)
+			authorizedActiveAdmin := authorizedAdmin.Group("/")
+			authorizedActiveAdmin.Use(middlewares.AuthorizedActiveAdmin(), middlewares.TwoFactorEnforced(), middlewares.LoadPermissions())
+			{
+				authorizedActiveAdmin.GET("/auth/permissions", controllers.GetMyPermissions)
+				authorizedActiveAdmin.PATCH("/auth/profile", controllers.UpdateMyProfile)
+
+				authorizedActiveAdmin.GET("/orders", middlewares.Permission(models.PermissionOrdersRead), controllers.GetOrders)
+				authorizedActiveAdmin.POST("/orders", middlewares.Permission(models.PermissionOrdersWrite), controllers.CreateOrder)
+				authorizedActiveAdmin.POST("/orders/totals/repair", middlewares.Permission(models.PermissionOrdersWrite), controllers.RepairOrderTotals)
+
+				authorizedActiveAdmin.GET("/customers", middlewares.Permission(models.PermissionCustomersRead), controllers.GetCustomers)
+
+				authorizedActiveAdmin.GET("/units", middlewares.Permission(models.PermissionCustomersRead), controllers.GetUnits)
+
+				authorizedActiveAdmin.GET("/vendors", middlewares.Permission(models.PermissionVendorsRead), controllers.GetVendors)
+				authorizedActiveAdmin.POST("/vendors", middlewares.Permission(models.PermissionVendorsWrite), controllers.CreateVendor)
+				authorizedActiveAdmin.GET("/vendors/:id", middlewares.Permission(models.PermissionVendorsRead), controllers.GetVendor)
+				authorizedActiveAdmin.PATCH("/vendors/:id", middlewares.Permission(models.PermissionVendorsWrite), controllers.UpdateVendor)
+
+				authorizedActiveAdmin.GET("/menus", middlewares.Permission(models.PermissionMenusRead), controllers.GetMenus)
+				authorizedActiveAdmin.POST("/menus", middlewares.Permission(models.PermissionMenusWrite), controllers.CreateMenu)
+				authorizedActiveAdmin.GET("/menus/:id", middlewares.Permission(models.PermissionMenusRead), controllers.GetMenu)
+				authorizedActiveAdmin.PATCH("/menus/:id", middlewares.Permission(models.PermissionMenusWrite), controllers.UpdateMenu)
+				authorizedActiveAdmin.POST("/menus/:id/deactivate", middlewares.Permission(models.PermissionMenusWrite), controllers.DeactivateMenu)
+
+				authorizedActiveAdmin.GET("/notifications", middlewares.Permission(models.PermissionNotificationsRead), controllers.GetNotifications)
+				authorizedActiveAdmin.POST("/notifications/:id/retry", middlewares.Permission(models.PermissionNotificationsWrite), controllers.RetryNotification)
+
+				authorizedActiveAdmin.GET("/templates", middlewares.Permission(models.PermissionTemplatesRead), controllers.GetTemplates)
+				authorizedActiveAdmin.GET("/templates/:name", middlewares.Permission(models.PermissionTemplatesRead), controllers.GetTemplate)
+				authorizedActiveAdmin.PUT("/templates/:name", middlewares.Permission(models.PermissionTemplatesWrite), controllers.SaveTemplate)
+				authorizedActiveAdmin.DELETE("/templates/:name", middlewares.Permission(models.PermissionTemplatesWrite), controllers.ResetTemplate)
+
+				authorizedActiveAdmin.GET("/orders/:id", middlewares.Permission(models.PermissionOrdersRead), controllers.GetOrder)
+				authorizedActiveAdmin.POST("/orders/:orderId/vendor/:vendorId/notify", middlewares.Permission(models.PermissionOrdersWrite), controllers.NotifyAVendorForAnOrder)
+				authorizedActiveAdmin.GET("/orders/:id/vendors", middlewares.Permission(models.PermissionOrdersRead), controllers.GetVendorsInAnOrder)
+				authorizedActiveAdmin.POST("/orders/:orderId/menus", middlewares.Permission(models.PermissionOrdersWrite), controllers.AddMenuToAnOrder)
+				authorizedActiveAdmin.POST("/orders/:orderId/cancel", middlewares.Permission(models.PermissionOrdersWrite), controllers.CancelOrder)
+				authorizedActiveAdmin.GET("/orders/:id/history", middlewares.Permission(models.PermissionOrdersRead), controllers.GetOrderHistory)
+				authorizedActiveAdmin.POST("/orders/dumps/:dumpId/restore", middlewares.Permission(models.PermissionOrdersWrite), controllers.RestoreOrder)
+
+				authorizedActiveAdmin.POST("/order-details/:orderDetailId/menu/:menuId/change", middlewares.Permission(models.PermissionOrdersWrite), controllers.ChangeMenuInAnOrder)
+				authorizedActiveAdmin.POST("/order-details/:orderDetailId/qty", middlewares.Permission(models.PermissionOrdersWrite), controllers.ChangeQtyOfAMenuInAnOrder)
+				authorizedActiveAdmin.POST("/order-details/:orderDetailId/note", middlewares.Permission(models.PermissionOrdersWrite), controllers.ChangeNoteOfAMenuInAnOrder)
+				authorizedActiveAdmin.PATCH("/order-details/:orderDetailId/status", middlewares.Permission(models.PermissionOrdersWrite), controllers.ChangeStatusOfAMenuInAnOrder)
+				authorizedActiveAdmin.DELETE("/order-details/:orderDetailId", middlewares.Permission(models.PermissionOrdersWrite), controllers.RemoveMenuFromAnOrder)
+				authorizedActiveAdmin.POST("/order-details/dumps/:dumpId/restore", middlewares.Permission(models.PermissionOrdersWrite), controllers.RestoreOrderDetail)
+				authorizedActiveAdmin.POST("/order-details/:orderDetailId/cost", middlewares.Permission(models.PermissionPricingWrite), controllers.AddCostToAnOrder)
+				authorizedActiveAdmin.POST("/order-details/:orderDetailId/discount", middlewares.Permission(models.PermissionPricingWrite), controllers.AddDiscountToAnOrder)
+
+				authorizedActiveAdmin.GET("/admins", middlewares.Permission(models.PermissionAdminsManage), controllers.GetAdmins)
+				authorizedActiveAdmin.GET("/admins/:id", middlewares.Permission(models.PermissionAdminsManage), controllers.GetAdmin)
+				authorizedActiveAdmin.PATCH("/admins/:id", middlewares.Permission(models.PermissionAdminsManage), controllers.UpdateAdmin)
+				authorizedActiveAdmin.POST("/admins/:id/reactivate", middlewares.Permission(models.PermissionAdminsManage), controllers.ReactivateAdmin)
+				authorizedActiveAdmin.GET("/admins/pending", middlewares.Permission(models.PermissionAdminsManage), controllers.GetPendingAdmins)
+				authorizedActiveAdmin.POST("/admins/:id/approve", middlewares.Permission(models.PermissionAdminsManage), controllers.ApproveAdmin)
+				authorizedActiveAdmin.POST("/admins/:id/reject", middlewares.Permission(models.PermissionAdminsManage), controllers.RejectAdmin)
+				authorizedActiveAdmin.POST("/admins/:id/logout", middlewares.Permission(models.PermissionAdminsManage), controllers.ForceLogoutAdmin)
+				authorizedActiveAdmin.POST("/admins/:id/deactivate", middlewares.Permission(models.PermissionAdminsManage), controllers.DeactivateAdmin)
+				authorizedActiveAdmin.POST("/admins/:id/unlock", middlewares.Permission(models.PermissionAdminsManage), controllers.UnlockAdminLogin)
+
+				authorizedActiveAdmin.GET("/roles", middlewares.Permission(models.PermissionRolesManage), controllers.GetRoles)
+				authorizedActiveAdmin.GET("/admins/:id/roles", middlewares.Permission(models.PermissionRolesManage), controllers.GetAdminRoles)
+				authorizedActiveAdmin.POST("/admins/:id/roles", middlewares.Permission(models.PermissionRolesManage), controllers.AssignAdminRole)
+				authorizedActiveAdmin.DELETE("/admins/:id/roles/:role", middlewares.Permission(models.PermissionRolesManage), controllers.RemoveAdminRole)
+
+				authorizedActiveAdmin.PUT("/settings/two-factor", middlewares.Permission(models.PermissionSettingsManage), controllers.RequireTwoFactor)
+			}
+		}
+	}
+
+	r.GET("/admin", controllers.Dashboard)
+	r.POST("/auth/login", controllers.AdminLogin)
+	r.POST("/auth/login/2fa", controllers.AdminLoginTwoFactor)
+	r.POST("/auth/register", controllers.AdminRegister)
+	r.POST("/auth/logout", controllers.Logout)
+	r.POST("/auth/forgot-password", controllers.ForgotPassword)
+	r.POST("/auth/reset-password", controllers.ResetPassword)
+	r.POST("/token/refresh", controllers.Refresh)
+	r.GET("/.well-known/jwks.json", controllers.JWKS)
+	r.POST("/telegram/webhook", controllers.TelegramWebhook)
+}
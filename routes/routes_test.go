@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupRegistersEveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// gin panics on conflicting wildcards when a route is registered
+	assert.NotPanics(t, func() { Setup(r) })
+
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	assert.True(t, registered["POST /orders/:orderId/menus"])
+	assert.True(t, registered["POST /orders/:orderId/vendor/:vendorId/notify"])
+	assert.True(t, registered["POST /auth/login"])
+}
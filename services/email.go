@@ -5,7 +5,6 @@ import (
 	"os"
 	"log"
 	"strconv"
-	"fmt"
 )
 
 func SendMail(mailTo string, mailSubject string, mailBody string) (bool, error) {
@@ -25,9 +24,7 @@ func SendMail(mailTo string, mailSubject string, mailBody string) (bool, error)
 
 	errSendingEmail := dialer.DialAndSend(msg)
 	if errSendingEmail != nil {
-		log.Fatal(errSendingEmail.Error())
-		fmt.Println(port)
-		fmt.Println(host)
+		log.Print("Failed to send email to ", mailTo, " through ", host, ":", port, ": ", errSendingEmail.Error())
 		return false, errSendingEmail
 	}
 	
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	ChannelTelegram = "Telegram"
+	ChannelEmail    = "Email"
+	ChannelWhatsapp = "Whatsapp"
+)
+
+// httpClient is shared by every call to an outside API, so a slow one cannot
+// hold a request or the notification worker forever.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Notifier delivers a message to a recipient over one channel. What the
+// recipient is depends on the channel: a chat ID, an email address or a phone
+// number. The subject is only used where the channel has one.
+type Notifier interface {
+	Channel() string
+	Send(recipient string, subject string, body string) error
+}
+
+type TelegramNotifier struct{}
+
+func (TelegramNotifier) Channel() string {
+	return ChannelTelegram
+}
+
+// Send sends body to the chat of recipient, or to the admin group when there
+// is no recipient.
+func (TelegramNotifier) Send(recipient string, subject string, body string) error {
+	if recipient == "" {
+		_, err := SendTelegramToGroup(body)
+		return err
+	}
+	_, err := SendTelegramToVendor(body, recipient)
+	return err
+}
+
+type EmailNotifier struct{}
+
+func (EmailNotifier) Channel() string {
+	return ChannelEmail
+}
+
+func (EmailNotifier) Send(recipient string, subject string, body string) error {
+	_, err := SendMail(recipient, subject, body)
+	return err
+}
+
+// WhatsappNotifier posts messages to the WhatsApp gateway at WHATSAPP_API_URL
+// as {"phone": ..., "message": ...}, authenticated by WHATSAPP_API_TOKEN.
+type WhatsappNotifier struct{}
+
+func (WhatsappNotifier) Channel() string {
+	return ChannelWhatsapp
+}
+
+func (WhatsappNotifier) Send(recipient string, subject string, body string) error {
+	apiUrl := os.Getenv("WHATSAPP_API_URL")
+	if apiUrl == "" {
+		return errors.New("whatsapp: WHATSAPP_API_URL belum diatur")
+	}
+	payload, err := json.Marshal(map[string]string{
+		"phone":   recipient,
+		"message": body,
+	})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", apiUrl, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+os.Getenv("WHATSAPP_API_TOKEN"))
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("whatsapp: %s: %s", response.Status, string(responseBody))
+	}
+	return nil
+}
+
+var notifiers = map[string]Notifier{
+	ChannelTelegram: TelegramNotifier{},
+	ChannelEmail:    EmailNotifier{},
+	ChannelWhatsapp: WhatsappNotifier{},
+}
+
+// GetNotifier returns the notifier of a channel, or false when there is none.
+func GetNotifier(channel string) (Notifier, bool) {
+	notifier, ok := notifiers[channel]
+	return notifier, ok
+}
+
+// RegisterNotifier replaces the notifier of its channel, e.g. with a fake one
+// in tests.
+func RegisterNotifier(notifier Notifier) {
+	notifiers[notifier.Channel()] = notifier
+}
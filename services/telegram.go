@@ -3,99 +3,160 @@ package services
 import (
 	"bytes"
 	"encoding/json"
-	"os"
-	"log"
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"log"
+	"os"
+	"strings"
 )
 
-var (
-	Token  string
-	ChatId string
-)
+var Token string
 
+// getUrl builds the bot API URL. TELEGRAM_API_URL points it somewhere else
+// than api.telegram.org, e.g. a local bot API server or a fake one in tests.
 func getUrl() string {
-	return fmt.Sprintf("https://api.telegram.org/bot%s", Token)
+	apiUrl := strings.TrimSuffix(os.Getenv("TELEGRAM_API_URL"), "/")
+	if apiUrl == "" {
+		apiUrl = "https://api.telegram.org"
+	}
+	return fmt.Sprintf("%s/bot%s", apiUrl, Token)
 }
 
-func SendTelegramToGroup(text string) (bool, error) {
-	// Global variables
-	var err error
-	var response *http.Response
+type TelegramUser struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username"`
+}
 
-	ChatId = os.Getenv("TELEGRAM_CHAT_ID")
+type TelegramChat struct {
+	ID int64 `json:"id"`
+}
+
+type TelegramMessage struct {
+	MessageID      int64            `json:"message_id"`
+	From           *TelegramUser    `json:"from"`
+	Chat           TelegramChat     `json:"chat"`
+	Text           string           `json:"text"`
+	ReplyToMessage *TelegramMessage `json:"reply_to_message"`
+}
+
+type TelegramCallbackQuery struct {
+	ID      string           `json:"id"`
+	From    TelegramUser     `json:"from"`
+	Message *TelegramMessage `json:"message"`
+	Data    string           `json:"data"`
+}
+
+// TelegramUpdate is what the bot API posts to the webhook.
+type TelegramUpdate struct {
+	UpdateID      int64                  `json:"update_id"`
+	Message       *TelegramMessage       `json:"message"`
+	CallbackQuery *TelegramCallbackQuery `json:"callback_query"`
+}
+
+type TelegramButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// callTelegram posts payload to a bot API method and fails when Telegram does
+// not answer with ok, e.g. when the chat cannot be reached.
+func callTelegram(method string, payload interface{}) error {
 	Token = os.Getenv("TELEGRAM_BOT_TOKEN")
 
-	// Send the message
-	url := fmt.Sprintf("%s/sendMessage", getUrl())
-	body, _ := json.Marshal(map[string]string{
-		"chat_id": ChatId,
-		"text":    text,
-		"parse_mode": "html",
-	})
-	response, err = http.Post(
-		url,
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	response, err := httpClient.Post(
+		fmt.Sprintf("%s/%s", getUrl(), method),
 		"application/json",
 		bytes.NewBuffer(body),
 	)
 	if err != nil {
-		return false, err
+		return err
 	}
-
-	// Close the request at the end
 	defer response.Body.Close()
 
-	// Body
 	body, err = ioutil.ReadAll(response.Body)
 	if err != nil {
-		return false, err
+		return err
 	}
-
-	// Log
-	log.Print("Message: ", text, " was sent")
 	log.Print("Response JSON: ", string(body))
 
-	// Return
+	var result struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if !result.Ok {
+		return fmt.Errorf("telegram: %s", result.Description)
+	}
+	return nil
+}
+
+func SendTelegramToGroup(text string) (bool, error) {
+	err := callTelegram("sendMessage", map[string]string{
+		"chat_id":    os.Getenv("TELEGRAM_CHAT_ID"),
+		"text":       text,
+		"parse_mode": "html",
+	})
+	if err != nil {
+		return false, err
+	}
+	log.Print("Message: ", text, " was sent")
 	return true, nil
 }
 
 func SendTelegramToVendor(text string, chatId string) (bool, error) {
-	// Global variables
-	var err error
-	var response *http.Response
-
-	ChatId = chatId
-	Token = os.Getenv("TELEGRAM_BOT_TOKEN")
-
-	// Send the message
-	url := fmt.Sprintf("%s/sendMessage", getUrl())
-	body, _ := json.Marshal(map[string]string{
-		"chat_id": ChatId,
+	err := callTelegram("sendMessage", map[string]string{
+		"chat_id": chatId,
 		"text":    text,
 	})
-	response, err = http.Post(
-		url,
-		"application/json",
-		bytes.NewBuffer(body),
-	)
 	if err != nil {
 		return false, err
 	}
+	log.Print("Message: ", text, " was sent")
+	return true, nil
+}
 
-	// Close the request at the end
-	defer response.Body.Close()
-
-	// Body
-	body, err = ioutil.ReadAll(response.Body)
+// SendTelegramWithButtons sends text with a row of inline keyboard buttons per
+// element of buttons. Pressing one comes back to the webhook as a callback
+// query carrying its CallbackData.
+func SendTelegramWithButtons(text string, chatId string, buttons [][]TelegramButton) (bool, error) {
+	err := callTelegram("sendMessage", map[string]interface{}{
+		"chat_id": chatId,
+		"text":    text,
+		"reply_markup": map[string]interface{}{
+			"inline_keyboard": buttons,
+		},
+	})
 	if err != nil {
 		return false, err
 	}
-
-	// Log
 	log.Print("Message: ", text, " was sent")
-	log.Print("Response JSON: ", string(body))
-
-	// Return
 	return true, nil
-}
\ No newline at end of file
+}
+
+// SendTelegramForceReply asks the chat to reply to text, so the next message
+// from it can be taken as the answer.
+func SendTelegramForceReply(text string, chatId string) error {
+	return callTelegram("sendMessage", map[string]interface{}{
+		"chat_id": chatId,
+		"text":    text,
+		"reply_markup": map[string]interface{}{
+			"force_reply": true,
+		},
+	})
+}
+
+// AnswerTelegramCallback stops the loading indicator on a pressed button and
+// shows text to whoever pressed it.
+func AnswerTelegramCallback(callbackQueryId string, text string) error {
+	return callTelegram("answerCallbackQuery", map[string]string{
+		"callback_query_id": callbackQueryId,
+		"text":              text,
+	})
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTelegram stands in for the bot API, answering every method with ok
+// unless the chat is "unreachable".
+func fakeTelegram(t *testing.T, requests map[string]map[string]interface{}) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]interface{}
+		json.Unmarshal(body, &payload)
+		requests[r.URL.Path] = payload
+		if payload["chat_id"] == "unreachable" {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"ok":false,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	t.Setenv("TELEGRAM_API_URL", server.URL)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:abc")
+	return server
+}
+
+func TestSendTelegramWithButtons(t *testing.T) {
+	requests := map[string]map[string]interface{}{}
+	server := fakeTelegram(t, requests)
+	defer server.Close()
+
+	sent, err := SendTelegramWithButtons("Ada order", "42", [][]TelegramButton{{{Text: "Terima", CallbackData: "accept:1:2"}}})
+	assert.NoError(t, err)
+	assert.True(t, sent)
+
+	payload := requests["/bot123:abc/sendMessage"]
+	assert.Equal(t, "42", payload["chat_id"])
+	keyboard := payload["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})
+	button := keyboard[0].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "accept:1:2", button["callback_data"])
+}
+
+func TestSendTelegramToVendorFails(t *testing.T) {
+	requests := map[string]map[string]interface{}{}
+	server := fakeTelegram(t, requests)
+	defer server.Close()
+
+	sent, err := SendTelegramToVendor("Ada order", "unreachable")
+	assert.False(t, sent)
+	assert.EqualError(t, err, "telegram: Bad Request: chat not found")
+}
@@ -0,0 +1,12 @@
+// Package templates holds the default message templates, which are built into
+// the binary. Each of them can be replaced by a file in TEMPLATES_DIR or by a
+// row in message_templates without a deploy.
+package templates
+
+import "embed"
+
+// Files are named after the event they announce. The .txt ones are rendered
+// with text/template and the .html ones with html/template.
+//
+//go:embed *.txt *.html
+var Files embed.FS
@@ -20,8 +20,10 @@ type TokenDetails struct {
 	RefreshToken string
 	AccessUuid   string
 	RefreshUuid  string
-	AtExpires    int64
-	RtExpires    int64
+	SessionId    string
+	// in seconds since the epoch, as the exp claim is read by other services
+	AtExpires int64
+	RtExpires int64
 }
 
 func getTokenDuration() (time.Duration, time.Duration) {
@@ -32,27 +34,33 @@ func getTokenDuration() (time.Duration, time.Duration) {
 	return accessTokenDuration, refreshTokenDuration
 }
 
-func CreateToken(userId uint64) (*TokenDetails, error) {
+// CreateToken creates the tokens of a session. An empty sessionId starts a new
+// session, as on login; a refresh passes the session of the old tokens.
+func CreateToken(userId uint64, sessionId string) (*TokenDetails, error) {
 	accessTokenDuration, refreshTokenDuration := getTokenDuration()
 
-	atExpires := time.Now().Add(accessTokenDuration).UnixMilli()
+	atExpires := time.Now().Add(accessTokenDuration).Unix()
 	td := &TokenDetails{}
 	td.AtExpires = atExpires
 	td.AccessUuid = uuid.NewV4().String()
 
-	td.RtExpires = time.Now().Add(refreshTokenDuration).UnixMilli()
+	td.RtExpires = time.Now().Add(refreshTokenDuration).Unix()
 	td.RefreshUuid = uuid.NewV4().String()
 
+	td.SessionId = sessionId
+	if td.SessionId == "" {
+		td.SessionId = uuid.NewV4().String()
+	}
+
 	var err error
 	// creating access token
-	os.Setenv("ACCESS_SECRET", "loremipsum")
 	atClaims := jwt.MapClaims{}
 	atClaims["authorized"] = true
 	atClaims["access_uuid"] = td.AccessUuid
+	atClaims["session_id"] = td.SessionId
 	atClaims["user_id"] = userId
 	atClaims["exp"] = atExpires
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	td.AccessToken, err = at.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+	td.AccessToken, err = accessKeys.sign(atClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -60,10 +68,10 @@ func CreateToken(userId uint64) (*TokenDetails, error) {
 	// creating refresh token
 	rtClaims := jwt.MapClaims{}
 	rtClaims["refresh_uuid"] = td.RefreshUuid
+	rtClaims["session_id"] = td.SessionId
 	rtClaims["user_id"] = userId
 	rtClaims["exp"] = td.RtExpires
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString([]byte(os.Getenv("REFRESH_SECRET")))
+	td.RefreshToken, err = refreshKeys.sign(rtClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +79,7 @@ func CreateToken(userId uint64) (*TokenDetails, error) {
 	return td, nil
 }
 
-func CreateAuth(userId uint64, td *TokenDetails) error {
+func CreateAuth(userId uint64, td *TokenDetails, client ClientInfo) error {
 	accessTokenDuration, refreshTokenDuration := getTokenDuration()
 
 	errAccess := services.GetRedis().Set(td.AccessUuid, strconv.Itoa(int(userId)), accessTokenDuration).Err()
@@ -84,11 +92,12 @@ func CreateAuth(userId uint64, td *TokenDetails) error {
 		return errRefresh
 	}
 
-	return nil
+	return recordSession(userId, td, client)
 }
 
 type AccessDetails struct {
 	AccessUuid string
+	SessionId  string
 	UserId     uint64
 }
 
@@ -109,8 +118,12 @@ func ExtractTokenMetadata(r *http.Request) (*AccessDetails, error) {
 			return nil, err
 		}
 
+		// tokens from before sessions were recorded have no session ID
+		sessionId, _ := claims["session_id"].(string)
+
 		return &AccessDetails{
 			AccessUuid: accessUuid,
+			SessionId:  sessionId,
 			UserId:     userId,
 		}, nil
 	}
@@ -139,19 +152,18 @@ func ExtractToken(r *http.Request) string {
 
 func VerifyToken(r *http.Request) (*jwt.Token, error) {
 	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// make sure that the token method conform to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("ACCESS_SECRET")), nil
-	})
+	// the key is picked by the kid header of the token
+	token, err := jwt.Parse(tokenString, accessKeys.keyFunc)
 	if err != nil {
 		return nil, err
 	}
 	return token, nil
 }
 
+func VerifyRefreshToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, refreshKeys.keyFunc)
+}
+
 func TokenValid(r *http.Request) error {
 	token, err := VerifyToken(r)
 	if err != nil {
@@ -183,6 +195,9 @@ func AuthCheck(c *gin.Context) (uint64, error) {
 	if err != nil {
 		return 0, err
 	}
+	if tokenAuth.SessionId != "" {
+		TouchSession(tokenAuth.SessionId, c.ClientIP())
+	}
 
 	return userId, nil
 }
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateTokenSetsExpiryInSeconds(t *testing.T) {
+	t.Setenv("TOKEN_SIGNING_METHOD", "")
+	t.Setenv("ACCESS_SECRET", "access")
+	t.Setenv("ACCESS_PREVIOUS_SECRETS", "")
+	t.Setenv("REFRESH_SECRET", "refresh")
+	t.Setenv("REFRESH_PREVIOUS_SECRETS", "")
+	t.Setenv("ACCESS_TOKEN_DURATION", "15")
+	t.Setenv("REFRESH_TOKEN_DURATION", "1440")
+	assert.NoError(t, LoadTokenKeys())
+
+	td, err := CreateToken(1, "")
+	assert.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(td.AccessToken, claims, accessKeys.keyFunc)
+	assert.NoError(t, err)
+	exp := time.Unix(int64(claims["exp"].(float64)), 0)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), exp, 5*time.Second)
+	assert.Equal(t, td.AtExpires, exp.Unix())
+
+	claims = jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(td.RefreshToken, claims, refreshKeys.keyFunc)
+	assert.NoError(t, err)
+	exp = time.Unix(int64(claims["exp"].(float64)), 0)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), exp, 5*time.Second)
+	assert.Equal(t, td.RtExpires, exp.Unix())
+}
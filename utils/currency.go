@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"strconv"
+)
+
+// FormatRupiah writes an amount the way it is read in Indonesia, e.g.
+// Rp1.250.000 or -Rp5.000.
+func FormatRupiah(amount int64) string {
+	var sign = ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	var grouped = ""
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped += "."
+		}
+		grouped += string(digit)
+	}
+	return sign + "Rp" + grouped
+}
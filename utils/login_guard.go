@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+const (
+	// failures are counted within this window, and a lock lasts as long
+	LoginFailureWindow = 15 * time.Minute
+	// failures of one email before it is locked
+	LoginMaxEmailFailures = 5
+	// failures from one IP before it is locked, higher since an office may
+	// share one address
+	LoginMaxIPFailures = 20
+	// the first failures are free of any delay, to forgive typos
+	loginFreeFailures = 2
+	loginMaxDelay     = 30 * time.Second
+)
+
+// LoginLock tells which email or IP got locked by a failed login.
+type LoginLock struct {
+	Email    bool
+	IP       bool
+	Failures int64
+}
+
+func (lock LoginLock) Locked() bool {
+	return lock.Email || lock.IP
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginFailuresKey(kind string, id string) string {
+	return "login-failures:" + kind + ":" + id
+}
+
+func loginWaitKey(kind string, id string) string {
+	return "login-wait:" + kind + ":" + id
+}
+
+func loginLockKey(kind string, id string) string {
+	return "login-lock:" + kind + ":" + id
+}
+
+// loginDelay is how long to wait before the next attempt after failures in a
+// row. It doubles with every failure past the free ones.
+func loginDelay(failures int64) time.Duration {
+	if failures <= loginFreeFailures {
+		return 0
+	}
+	delay := time.Second << uint(failures-loginFreeFailures-1)
+	if delay > loginMaxDelay || delay <= 0 {
+		return loginMaxDelay
+	}
+	return delay
+}
+
+// LoginRetryAfter tells how long email and ip have to wait before they may try
+// to log in again, because of a lock or of the delay after a failure. Zero
+// means they may try now.
+func LoginRetryAfter(email string, ip string) (time.Duration, error) {
+	email = normalizeLoginEmail(email)
+	keys := []string{
+		loginLockKey("email", email),
+		loginLockKey("ip", ip),
+		loginWaitKey("email", email),
+		loginWaitKey("ip", ip),
+	}
+	var longest time.Duration
+	for _, key := range keys {
+		ttl, err := services.GetRedis().PTTL(key).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest, nil
+}
+
+func countLoginFailure(kind string, id string, max int64) (int64, bool, error) {
+	client := services.GetRedis()
+	failures, err := client.Incr(loginFailuresKey(kind, id)).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	if failures == 1 {
+		if err := client.Expire(loginFailuresKey(kind, id), LoginFailureWindow).Err(); err != nil {
+			return 0, false, err
+		}
+	}
+	if failures >= max {
+		pipe := client.TxPipeline()
+		pipe.Set(loginLockKey(kind, id), failures, LoginFailureWindow)
+		pipe.Del(loginFailuresKey(kind, id), loginWaitKey(kind, id))
+		_, err := pipe.Exec()
+		return failures, true, err
+	}
+	if delay := loginDelay(failures); delay > 0 {
+		if err := client.Set(loginWaitKey(kind, id), failures, delay).Err(); err != nil {
+			return 0, false, err
+		}
+	}
+	return failures, false, nil
+}
+
+// RecordLoginFailure counts a failed login of email from ip, and locks either
+// of them once it failed too many times.
+func RecordLoginFailure(email string, ip string) (LoginLock, error) {
+	var lock LoginLock
+	failures, locked, err := countLoginFailure("email", normalizeLoginEmail(email), LoginMaxEmailFailures)
+	if err != nil {
+		return lock, err
+	}
+	lock.Email, lock.Failures = locked, failures
+	failures, locked, err = countLoginFailure("ip", ip, LoginMaxIPFailures)
+	if err != nil {
+		return lock, err
+	}
+	lock.IP = locked
+	if locked {
+		lock.Failures = failures
+	}
+	return lock, nil
+}
+
+// ClearLoginFailures forgets the failures of email after it logged in. The
+// failures of the IP are kept, so one good account cannot be used to keep
+// guessing others.
+func ClearLoginFailures(email string) error {
+	email = normalizeLoginEmail(email)
+	return services.GetRedis().Del(loginFailuresKey("email", email), loginWaitKey("email", email)).Err()
+}
+
+// UnlockLogin lifts the lock of email before it runs out, together with the
+// lock of ip when one is given, e.g. the office network of the admin which got
+// locked during the same attack. It tells whether there was a lock to lift.
+func UnlockLogin(email string, ip string) (bool, error) {
+	deleted, err := services.GetRedis().Del(unlockLoginKeys(email, ip)...).Result()
+	return deleted > 0, err
+}
+
+func unlockLoginKeys(email string, ip string) []string {
+	email = normalizeLoginEmail(email)
+	keys := []string{loginLockKey("email", email), loginFailuresKey("email", email), loginWaitKey("email", email)}
+	if ip != "" {
+		keys = append(keys, loginLockKey("ip", ip), loginFailuresKey("ip", ip), loginWaitKey("ip", ip))
+	}
+	return keys
+}
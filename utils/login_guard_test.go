@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginDelayGrowsAfterFreeFailures(t *testing.T) {
+	assert.Equal(t, time.Duration(0), loginDelay(1))
+	assert.Equal(t, time.Duration(0), loginDelay(2))
+	assert.Equal(t, time.Second, loginDelay(3))
+	assert.Equal(t, 2*time.Second, loginDelay(4))
+	assert.Equal(t, 4*time.Second, loginDelay(5))
+	assert.Equal(t, loginMaxDelay, loginDelay(15))
+	assert.Equal(t, loginMaxDelay, loginDelay(200))
+}
+
+func TestUnlockLoginKeys(t *testing.T) {
+	assert.Equal(t, []string{
+		"login-lock:email:sari@itsfood.id", "login-failures:email:sari@itsfood.id", "login-wait:email:sari@itsfood.id",
+	}, unlockLoginKeys(" Sari@itsfood.id", ""))
+	assert.Equal(t, []string{
+		"login-lock:email:sari@itsfood.id", "login-failures:email:sari@itsfood.id", "login-wait:email:sari@itsfood.id",
+		"login-lock:ip:10.0.0.2", "login-failures:ip:10.0.0.2", "login-wait:ip:10.0.0.2",
+	}, unlockLoginKeys("sari@itsfood.id", "10.0.0.2"))
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+// RateLimit counts a hit on key and tells whether it is still within limit
+// hits per window. When it is not, it also tells how long until the window
+// ends.
+func RateLimit(key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	key = "rate-limit:" + key
+	hits, err := services.GetRedis().Incr(key).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	if hits == 1 {
+		if err := services.GetRedis().Expire(key, window).Err(); err != nil {
+			return false, 0, err
+		}
+	}
+	if hits <= limit {
+		return true, 0, nil
+	}
+	retryAfter, err := services.GetRedis().TTL(key).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	if retryAfter < 0 {
+		// the expiry got lost, so start the window again
+		services.GetRedis().Expire(key, window)
+		retryAfter = window
+	}
+	return false, retryAfter, nil
+}
@@ -0,0 +1,343 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	redis "github.com/go-redis/redis/v7"
+
+	"github.com/adeindriawan/itsfood-administration/services"
+)
+
+// a session is marked as used at most this often, so that not every request
+// writes to redis
+const sessionTouchInterval = time.Minute
+
+// Session is one login of a user, from the password until it is logged out or
+// its refresh token expires. Refreshing keeps the session and replaces its
+// tokens.
+type Session struct {
+	ID          string    `json:"id"`
+	UserID      uint64    `json:"user_id"`
+	AccessUuid  string    `json:"-"`
+	RefreshUuid string    `json:"-"`
+	Device      string    `json:"device"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+}
+
+// ClientInfo is what is recorded about the client of a session.
+type ClientInfo struct {
+	Device    string
+	IP        string
+	UserAgent string
+}
+
+// NewClientInfo describes the client of a request. The device is the name the
+// client gives in X-Device-Name, or guessed from its user agent.
+func NewClientInfo(r *http.Request, ip string) ClientInfo {
+	userAgent := r.UserAgent()
+	device := strings.TrimSpace(r.Header.Get("X-Device-Name"))
+	if device == "" {
+		device = describeDevice(userAgent)
+	}
+	return ClientInfo{Device: device, IP: ip, UserAgent: userAgent}
+}
+
+func describeDevice(userAgent string) string {
+	var system, browser string
+	for _, candidate := range []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iPhone"}, {"iPad", "iPad"},
+		{"Windows", "Windows"}, {"Mac OS", "macOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			system = candidate.name
+			break
+		}
+	}
+	// the order matters, as Edge and Chrome also claim to be Safari
+	for _, candidate := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+	switch {
+	case system != "" && browser != "":
+		return browser + " di " + system
+	case system != "":
+		return system
+	case browser != "":
+		return browser
+	}
+	return "Perangkat tidak dikenal"
+}
+
+func sessionKey(sessionId string) string {
+	return "session:" + sessionId
+}
+
+func userSessionsKey(userId uint64) string {
+	return "user-sessions:" + strconv.FormatUint(userId, 10)
+}
+
+// the fields of the session hash, written separately by login, refresh and
+// every request, so none of them overwrites what the others just wrote
+const (
+	sessionUserId      = "user_id"
+	sessionAccessUuid  = "access_uuid"
+	sessionRefreshUuid = "refresh_uuid"
+	sessionDevice      = "device"
+	sessionIP          = "ip"
+	sessionUserAgent   = "user_agent"
+	sessionCreatedAt   = "created_at"
+	sessionLastUsedAt  = "last_used_at"
+)
+
+// updateSessionScript updates fields of a session only while it still
+// exists, so a request finishing after its session was revoked does not bring
+// back a broken session without an expiry.
+var updateSessionScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], unpack(ARGV))
+return 1
+`)
+
+func formatSessionTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseSession reads a session from the fields of its hash. An empty hash
+// means the session does not exist.
+func parseSession(sessionId string, fields map[string]string) (Session, error) {
+	session := Session{
+		ID:          sessionId,
+		AccessUuid:  fields[sessionAccessUuid],
+		RefreshUuid: fields[sessionRefreshUuid],
+		Device:      fields[sessionDevice],
+		IP:          fields[sessionIP],
+		UserAgent:   fields[sessionUserAgent],
+	}
+	if len(fields) == 0 {
+		return session, redis.Nil
+	}
+	var err error
+	if session.UserID, err = strconv.ParseUint(fields[sessionUserId], 10, 64); err != nil {
+		return session, err
+	}
+	if session.CreatedAt, err = time.Parse(time.RFC3339Nano, fields[sessionCreatedAt]); err != nil {
+		return session, err
+	}
+	if session.LastUsedAt, err = time.Parse(time.RFC3339Nano, fields[sessionLastUsedAt]); err != nil {
+		return session, err
+	}
+	return session, nil
+}
+
+// GetSession loads a session. It returns redis.Nil when the session expired
+// or was revoked.
+func GetSession(sessionId string) (Session, error) {
+	fields, err := services.GetRedis().HGetAll(sessionKey(sessionId)).Result()
+	if err != nil {
+		return Session{ID: sessionId}, err
+	}
+	return parseSession(sessionId, fields)
+}
+
+// recordSession stores the tokens of td under their session, creating the
+// session on login and moving it to the new tokens on refresh.
+func recordSession(userId uint64, td *TokenDetails, client ClientInfo) error {
+	_, refreshTokenDuration := getTokenDuration()
+	now := formatSessionTime(time.Now())
+	key := sessionKey(td.SessionId)
+
+	oldAccessUuid, err := services.GetRedis().HGet(key, sessionAccessUuid).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	// the access token paired with the refresh token just rotated would
+	// otherwise stay valid until it expires
+	if oldAccessUuid != "" && oldAccessUuid != td.AccessUuid {
+		if err := services.GetRedis().Del(oldAccessUuid).Err(); err != nil {
+			return err
+		}
+	}
+
+	fields := []interface{}{
+		sessionAccessUuid, td.AccessUuid,
+		sessionRefreshUuid, td.RefreshUuid,
+		sessionIP, client.IP,
+		sessionUserAgent, client.UserAgent,
+		sessionLastUsedAt, now,
+	}
+	indexKey := userSessionsKey(userId)
+	if err == redis.Nil {
+		fields = append(fields,
+			sessionUserId, strconv.FormatUint(userId, 10),
+			sessionDevice, client.Device,
+			sessionCreatedAt, now,
+		)
+		_, err = services.GetRedis().TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.HSet(key, fields...)
+			pipe.Expire(key, refreshTokenDuration)
+			return nil
+		})
+	} else {
+		var updated int64
+		updated, err = updateSessionScript.Run(services.GetRedis(), []string{key}, fields...).Int64()
+		if err == nil && updated == 0 {
+			// revoked while it was being refreshed, so the new tokens must
+			// not outlive it
+			services.GetRedis().Del(td.AccessUuid, td.RefreshUuid)
+			err = redis.Nil
+		}
+		if err == nil {
+			err = services.GetRedis().Expire(key, refreshTokenDuration).Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = services.GetRedis().TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(indexKey, td.SessionId)
+		// the index lives as long as the newest session in it
+		pipe.Expire(indexKey, refreshTokenDuration)
+		return nil
+	})
+	return err
+}
+
+// TouchSession records that a session was just used from ip. It only writes
+// when and where the session was used, never its tokens.
+func TouchSession(sessionId string, ip string) error {
+	key := sessionKey(sessionId)
+	values, err := services.GetRedis().HMGet(key, sessionLastUsedAt, sessionIP).Result()
+	if err != nil {
+		return err
+	}
+	lastUsedAt, _ := values[0].(string)
+	lastIP, _ := values[1].(string)
+	if lastUsedAt == "" {
+		return redis.Nil
+	}
+	if last, err := time.Parse(time.RFC3339Nano, lastUsedAt); err == nil && time.Since(last) < sessionTouchInterval && lastIP == ip {
+		return nil
+	}
+	return updateSessionScript.Run(services.GetRedis(), []string{key}, sessionLastUsedAt, formatSessionTime(time.Now()), sessionIP, ip).Err()
+}
+
+// GetUserSessions lists the sessions of a user which are still alive, the
+// most recently used first.
+func GetUserSessions(userId uint64) ([]Session, error) {
+	key := userSessionsKey(userId)
+	sessionIds, err := services.GetRedis().SMembers(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	var sessions = []Session{}
+	for _, sessionId := range sessionIds {
+		session, err := GetSession(sessionId)
+		if err == redis.Nil {
+			// expired on its own, drop it from the index
+			services.GetRedis().SRem(key, sessionId)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+// DeleteSession revokes a session of a user together with its tokens. It
+// returns redis.Nil when the user has no such session.
+func DeleteSession(userId uint64, sessionId string) error {
+	session, err := GetSession(sessionId)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userId {
+		return redis.Nil
+	}
+	if err := services.GetRedis().Del(session.AccessUuid, session.RefreshUuid, sessionKey(sessionId)).Err(); err != nil {
+		return err
+	}
+	return services.GetRedis().SRem(userSessionsKey(userId), sessionId).Err()
+}
+
+// DeleteUserSessions revokes every session of a user except the one in
+// keepSessionId, which can be empty, and reports how many were revoked.
+func DeleteUserSessions(userId uint64, keepSessionId string) (int, error) {
+	sessions, err := GetUserSessions(userId)
+	if err != nil {
+		return 0, err
+	}
+	var deleted = 0
+	for _, session := range sessions {
+		if session.ID == keepSessionId {
+			continue
+		}
+		if err := DeleteSession(userId, session.ID); err != nil && err != redis.Nil {
+			return deleted, err
+		}
+		deleted += 1
+	}
+	return deleted, nil
+}
+
+// ErrRefreshTokenReused is returned for a refresh token which was already
+// exchanged for new tokens. Its session has been revoked by then.
+var ErrRefreshTokenReused = errors.New("refresh token sudah pernah dipakai")
+
+// ErrRefreshTokenRevoked is returned for a refresh token which is no longer
+// valid, as its session ended.
+var ErrRefreshTokenRevoked = errors.New("refresh token sudah tidak berlaku")
+
+func rotatedRefreshKey(refreshUuid string) string {
+	return "rotated-refresh:" + refreshUuid
+}
+
+// ConsumeRefreshToken uses up a refresh token of a session before it is
+// exchanged for new tokens. The tokens of a session form a family: once a
+// refresh token is rotated, presenting it again means it was copied, so the
+// whole session is revoked and ErrRefreshTokenReused is returned.
+func ConsumeRefreshToken(userId uint64, refreshUuid string, sessionId string) error {
+	_, refreshTokenDuration := getTokenDuration()
+	deleted, err := services.GetRedis().Del(refreshUuid).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 1 {
+		if sessionId == "" {
+			return nil
+		}
+		return services.GetRedis().Set(rotatedRefreshKey(refreshUuid), sessionId, refreshTokenDuration).Err()
+	}
+
+	if sessionId != "" {
+		owner, err := services.GetRedis().Get(rotatedRefreshKey(refreshUuid)).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if owner == sessionId {
+			if err := DeleteSession(userId, sessionId); err != nil && err != redis.Nil {
+				return err
+			}
+			return ErrRefreshTokenReused
+		}
+	}
+	return ErrRefreshTokenRevoked
+}
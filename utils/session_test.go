@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	redis "github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeDevice(t *testing.T) {
+	assert.Equal(t, "Chrome di Android", describeDevice("Mozilla/5.0 (Linux; Android 13; SM-A546E) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36"))
+	assert.Equal(t, "Edge di Windows", describeDevice("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46"))
+	assert.Equal(t, "Safari di iPhone", describeDevice("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"))
+	assert.Equal(t, "Perangkat tidak dikenal", describeDevice("curl/8.0.1"))
+}
+
+func TestParseSession(t *testing.T) {
+	session, err := parseSession("s-1", map[string]string{
+		"user_id":      "21",
+		"access_uuid":  "a-1",
+		"refresh_uuid": "r-1",
+		"device":       "Chrome di Android",
+		"ip":           "10.0.0.2",
+		"user_agent":   "Mozilla/5.0",
+		"created_at":   "2022-09-01T08:00:00Z",
+		"last_used_at": "2022-09-01T09:30:00.5Z",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(21), session.UserID)
+	assert.Equal(t, "a-1", session.AccessUuid)
+	assert.Equal(t, "10.0.0.2", session.IP)
+	assert.Equal(t, time.Date(2022, 9, 1, 9, 30, 0, 500000000, time.UTC), session.LastUsedAt)
+
+	_, err = parseSession("s-2", map[string]string{})
+	assert.Equal(t, redis.Nil, err)
+}
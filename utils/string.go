@@ -17,6 +17,10 @@ func SanitizePhoneNumber(number string) (string, error) {
 		return "", errNumberTooLong
 	}
 
+	if len(phoneNumber) < 2 {
+		return "", errNumberNotValid
+	}
+
 	if phoneNumber[0:2] == "62" {
 		return phoneNumber, nil
 	}
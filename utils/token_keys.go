@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// signingKey is one key tokens are signed or verified with. Its ID goes in
+// the kid header of the tokens it signs, so the right key can be picked when
+// several are accepted during a rotation.
+type signingKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Sign is nil for a key which is only kept to verify older tokens.
+	Sign   interface{}
+	Verify interface{}
+}
+
+// keyRing holds the key new tokens are signed with and every key a token is
+// still accepted from.
+type keyRing struct {
+	current *signingKey
+	keys    map[string]*signingKey
+}
+
+func (ring *keyRing) add(key *signingKey) {
+	if _, exists := ring.keys[key.ID]; !exists {
+		ring.keys[key.ID] = key
+	}
+}
+
+// keyFunc picks the key to verify a token with from its kid header. A token
+// without one was signed before kid was introduced and is checked against the
+// current key.
+func (ring *keyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	if ring == nil || ring.current == nil {
+		return nil, errors.New("kunci token belum dimuat")
+	}
+	key := ring.current
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = ring.keys[kid]; !ok {
+			return nil, fmt.Errorf("kunci token dengan kid %s tidak dikenal", kid)
+		}
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Verify, nil
+}
+
+func (ring *keyRing) sign(claims jwt.Claims) (string, error) {
+	if ring == nil || ring.current == nil {
+		return "", errors.New("kunci token belum dimuat")
+	}
+	token := jwt.NewWithClaims(ring.current.Method, claims)
+	token.Header["kid"] = ring.current.ID
+	return token.SignedString(ring.current.Sign)
+}
+
+var accessKeys, refreshKeys *keyRing
+
+// keyIdOf derives the ID of a key from its material, so it stays the same on
+// every instance without being configured.
+func keyIdOf(material []byte) string {
+	sum := sha256.Sum256(material)
+	return hex.EncodeToString(sum[:8])
+}
+
+func hmacKey(secret string) *signingKey {
+	return &signingKey{ID: keyIdOf([]byte(secret)), Method: jwt.SigningMethodHS256, Sign: []byte(secret), Verify: []byte(secret)}
+}
+
+// splitList splits a ;-separated list from the environment and drops the
+// empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadHMACKeys reads the secret in secretVar and the secrets still accepted
+// in previousVar.
+func loadHMACKeys(secretVar string, previousVar string) (*keyRing, error) {
+	secret := os.Getenv(secretVar)
+	if secret == "" {
+		return nil, errors.New(secretVar + " belum diisi")
+	}
+	ring := &keyRing{keys: map[string]*signingKey{}}
+	ring.current = hmacKey(secret)
+	ring.add(ring.current)
+	for _, previous := range splitList(os.Getenv(previousVar)) {
+		key := hmacKey(previous)
+		key.Sign = nil
+		ring.add(key)
+	}
+	return ring, nil
+}
+
+func publicKeyId(publicKey interface{}) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return keyIdOf(der), nil
+}
+
+func parsePrivateKey(method jwt.SigningMethod, pem []byte) (interface{}, interface{}, error) {
+	switch method {
+	case jwt.SigningMethodRS256:
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, nil, err
+		}
+		return privateKey, &privateKey.PublicKey, nil
+	case jwt.SigningMethodEdDSA:
+		privateKey, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, nil, err
+		}
+		return privateKey, privateKey.(ed25519.PrivateKey).Public(), nil
+	}
+	return nil, nil, errors.New("metode tanda tangan " + method.Alg() + " tidak didukung")
+}
+
+func parsePublicKey(method jwt.SigningMethod, pem []byte) (interface{}, error) {
+	if method == jwt.SigningMethodRS256 {
+		return jwt.ParseRSAPublicKeyFromPEM(pem)
+	}
+	return jwt.ParseEdPublicKeyFromPEM(pem)
+}
+
+// loadAsymmetricKeys reads the private key in ACCESS_PRIVATE_KEY_FILE and the
+// public keys still accepted in ACCESS_PREVIOUS_PUBLIC_KEY_FILES.
+func loadAsymmetricKeys(method jwt.SigningMethod) (*keyRing, error) {
+	privateKeyFile := os.Getenv("ACCESS_PRIVATE_KEY_FILE")
+	if privateKeyFile == "" {
+		return nil, errors.New("ACCESS_PRIVATE_KEY_FILE belum diisi untuk " + method.Alg())
+	}
+	pem, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, publicKey, err := parsePrivateKey(method, pem)
+	if err != nil {
+		return nil, errors.New("gagal membaca ACCESS_PRIVATE_KEY_FILE: " + err.Error())
+	}
+	kid, err := publicKeyId(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	ring := &keyRing{keys: map[string]*signingKey{}}
+	ring.current = &signingKey{ID: kid, Method: method, Sign: privateKey, Verify: publicKey}
+	ring.add(ring.current)
+
+	for _, publicKeyFile := range splitList(os.Getenv("ACCESS_PREVIOUS_PUBLIC_KEY_FILES")) {
+		pem, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := parsePublicKey(method, pem)
+		if err != nil {
+			return nil, errors.New("gagal membaca " + publicKeyFile + ": " + err.Error())
+		}
+		kid, err := publicKeyId(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		ring.add(&signingKey{ID: kid, Method: method, Verify: publicKey})
+	}
+	return ring, nil
+}
+
+// LoadTokenKeys loads the keys tokens are signed with, and fails when they
+// are not configured. Access tokens are signed with ACCESS_SECRET, or with a
+// private key when TOKEN_SIGNING_METHOD is RS256 or EdDSA so that other
+// services can verify them from the JWKS. Refresh tokens are only read by
+// this service and always use REFRESH_SECRET.
+func LoadTokenKeys() error {
+	var access *keyRing
+	var err error
+	switch method := os.Getenv("TOKEN_SIGNING_METHOD"); method {
+	case "", jwt.SigningMethodHS256.Alg():
+		access, err = loadHMACKeys("ACCESS_SECRET", "ACCESS_PREVIOUS_SECRETS")
+	case jwt.SigningMethodRS256.Alg():
+		access, err = loadAsymmetricKeys(jwt.SigningMethodRS256)
+	case jwt.SigningMethodEdDSA.Alg():
+		access, err = loadAsymmetricKeys(jwt.SigningMethodEdDSA)
+	default:
+		err = errors.New("TOKEN_SIGNING_METHOD " + method + " tidak didukung")
+	}
+	if err != nil {
+		return err
+	}
+	refresh, err := loadHMACKeys("REFRESH_SECRET", "REFRESH_PREVIOUS_SECRETS")
+	if err != nil {
+		return err
+	}
+	accessKeys, refreshKeys = access, refresh
+	return nil
+}
+
+// JWK is a public key as published in the JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// AccessTokenJWKS lists the public keys access tokens can be verified with.
+// It is empty when access tokens are signed with a shared secret.
+func AccessTokenJWKS() []JWK {
+	var jwks = []JWK{}
+	if accessKeys == nil {
+		return jwks
+	}
+	for _, key := range accessKeys.keys {
+		jwk := JWK{Use: "sig", Alg: key.Method.Alg(), Kid: key.ID}
+		switch publicKey := key.Verify.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
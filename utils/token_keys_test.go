@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTokenKeysNeedsSecrets(t *testing.T) {
+	t.Setenv("TOKEN_SIGNING_METHOD", "")
+	t.Setenv("ACCESS_SECRET", "")
+	t.Setenv("REFRESH_SECRET", "refresh")
+	assert.Error(t, LoadTokenKeys())
+
+	t.Setenv("ACCESS_SECRET", "access")
+	t.Setenv("REFRESH_SECRET", "")
+	assert.Error(t, LoadTokenKeys())
+}
+
+func TestHMACKeyRotation(t *testing.T) {
+	t.Setenv("TOKEN_SIGNING_METHOD", "")
+	t.Setenv("ACCESS_SECRET", "old")
+	t.Setenv("ACCESS_PREVIOUS_SECRETS", "")
+	t.Setenv("REFRESH_SECRET", "refresh")
+	assert.NoError(t, LoadTokenKeys())
+	oldToken, err := accessKeys.sign(jwt.MapClaims{"user_id": 1})
+	assert.NoError(t, err)
+
+	// rotated: the old secret is still accepted
+	t.Setenv("ACCESS_SECRET", "new")
+	t.Setenv("ACCESS_PREVIOUS_SECRETS", "old")
+	assert.NoError(t, LoadTokenKeys())
+	newToken, err := accessKeys.sign(jwt.MapClaims{"user_id": 1})
+	assert.NoError(t, err)
+	_, err = jwt.Parse(oldToken, accessKeys.keyFunc)
+	assert.NoError(t, err)
+	_, err = jwt.Parse(newToken, accessKeys.keyFunc)
+	assert.NoError(t, err)
+
+	// retired: only the new secret is left
+	t.Setenv("ACCESS_PREVIOUS_SECRETS", "")
+	assert.NoError(t, LoadTokenKeys())
+	_, err = jwt.Parse(oldToken, accessKeys.keyFunc)
+	assert.Error(t, err)
+
+	// a refresh token is never accepted as an access token
+	refreshToken, err := refreshKeys.sign(jwt.MapClaims{"user_id": 1})
+	assert.NoError(t, err)
+	_, err = jwt.Parse(refreshToken, accessKeys.keyFunc)
+	assert.Error(t, err)
+	assert.Empty(t, AccessTokenJWKS())
+}
+
+func TestEdDSAKeysArePublished(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "access.pem")
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	t.Setenv("TOKEN_SIGNING_METHOD", "EdDSA")
+	t.Setenv("ACCESS_PRIVATE_KEY_FILE", keyFile)
+	t.Setenv("ACCESS_PREVIOUS_PUBLIC_KEY_FILES", "")
+	t.Setenv("REFRESH_SECRET", "refresh")
+	assert.NoError(t, LoadTokenKeys())
+
+	token, err := accessKeys.sign(jwt.MapClaims{"user_id": 1})
+	assert.NoError(t, err)
+	parsed, err := jwt.Parse(token, accessKeys.keyFunc)
+	assert.NoError(t, err)
+
+	jwks := AccessTokenJWKS()
+	if assert.Len(t, jwks, 1) {
+		assert.Equal(t, "OKP", jwks[0].Kty)
+		assert.Equal(t, "EdDSA", jwks[0].Alg)
+		assert.Equal(t, parsed.Header["kid"], jwks[0].Kid)
+	}
+}